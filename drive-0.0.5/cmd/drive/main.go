@@ -24,6 +24,7 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/odeke-em/drive/config"
 	"github.com/odeke-em/drive/src"
@@ -40,21 +41,32 @@ func main() {
 	}
 	runtime.GOMAXPROCS(int(maxProcs))
 
+	flag.BoolVar(&drive.OutputJSON, "json", false, "writes newline delimited JSON records instead of text")
+
 	command.On(drive.AboutKey, drive.DescAbout, &aboutCmd{}, []string{})
+	command.On(drive.ApplyKey, drive.DescApply, &applyCmd{}, []string{})
+	command.On(drive.ChecksumsKey, drive.DescChecksums, &checksumsCmd{}, []string{})
+	command.On(drive.DaemonKey, drive.DescDaemon, &daemonCmd{}, []string{})
 	command.On(drive.DiffKey, drive.DescDiff, &diffCmd{}, []string{})
 	command.On(drive.EmptyTrashKey, drive.DescEmptyTrash, &emptyTrashCmd{}, []string{})
 	command.On(drive.FeaturesKey, drive.DescFeatures, &featuresCmd{}, []string{})
 	command.On(drive.InitKey, drive.DescInit, &initCmd{}, []string{})
 	command.On(drive.HelpKey, drive.DescHelp, &helpCmd{}, []string{})
 	command.On(drive.ListKey, drive.DescList, &listCmd{}, []string{})
+	command.On(drive.LogKey, drive.DescLog, &logCmd{}, []string{})
+	command.On(drive.MountKey, drive.DescMount, &mountCmd{}, []string{})
+	command.On(drive.SparseKey, drive.DescSparse, &sparseCmd{}, []string{})
 	command.On(drive.PullKey, drive.DescPull, &pullCmd{}, []string{})
 	command.On(drive.PushKey, drive.DescPush, &pushCmd{}, []string{})
 	command.On(drive.PubKey, drive.DescPublish, &publishCmd{}, []string{})
 	command.On(drive.QuotaKey, drive.DescQuota, &quotaCmd{}, []string{})
+	command.On(drive.ResumeKey, drive.DescResume, &resumeCmd{}, []string{})
+	command.On(drive.SyncKey, drive.DescSync, &syncCmd{}, []string{})
 	command.On(drive.TouchKey, drive.DescTouch, &touchCmd{}, []string{})
 	command.On(drive.TrashKey, drive.DescTrash, &trashCmd{}, []string{})
 	command.On(drive.UntrashKey, drive.DescUntrash, &untrashCmd{}, []string{})
 	command.On(drive.UnpubKey, drive.DescUnpublish, &unpublishCmd{}, []string{})
+	command.On(drive.WatchKey, drive.DescWatch, &watchCmd{}, []string{})
 	command.On(drive.VersionKey, drive.Version, &versionCmd{}, []string{})
 	command.ParseAndRun()
 }
@@ -180,6 +192,12 @@ func (cmd *listCmd) Run(args []string) {
 }
 
 type pullCmd struct {
+	wait       *bool
+	mounts     *string
+	conflicts  *string
+	symlinks   *string
+	jobs       *int
+	planOut    *string
 	exportsDir *string
 	export     *string
 	force      *bool
@@ -198,7 +216,13 @@ func (cmd *pullCmd) Flags(fs *flag.FlagSet) *flag.FlagSet {
 	cmd.hidden = fs.Bool("hidden", false, "allows pulling of hidden paths")
 	cmd.force = fs.Bool("force", false, "forces a pull even if no changes present")
 	cmd.exportsDir = fs.String("export-dir", "", "directory to place exports")
+	cmd.jobs = fs.Int("j", drive.DefaultJobs, "maximum number of concurrent tasks")
+	cmd.planOut = fs.String("plan-out", "", "saves the resolved changes to this path for `drive apply`")
+	cmd.symlinks = fs.String("symlinks", drive.SymlinksFollow, "policy for local symlinks: follow, skip or preserve")
 
+	cmd.conflicts = fs.String("conflicts", drive.ConflictReport, "policy for paths that are a folder on one side and a file on the other: report, rename or replace")
+	cmd.mounts = fs.String("mount", "", "comma separated list of remote_path=local_path mounts outside of the context")
+	cmd.wait = fs.Bool("wait", false, "waits for the lock of the context to be released instead of failing")
 	return fs
 }
 
@@ -213,6 +237,10 @@ func nonEmptyStrings(v []string) (splits []string) {
 
 func (cmd *pullCmd) Run(args []string) {
 	sources, context, path := preprocessArgs(args)
+	mounts := parseMounts(context, *cmd.mounts)
+	if len(mounts) >= 1 && len(args) < 1 {
+		sources = nil
+	}
 
 	// Filter out empty strings.
 	exports := nonEmptyStrings(strings.Split(*cmd.export, ","))
@@ -222,15 +250,27 @@ func (cmd *pullCmd) Run(args []string) {
 		ExportsDir: strings.Trim(*cmd.exportsDir, " "),
 		Force:      *cmd.force,
 		Hidden:     *cmd.hidden,
+		Jobs:       *cmd.jobs,
 		NoPrompt:   *cmd.noPrompt,
 		NoClobber:  *cmd.noClobber,
 		Path:       path,
+		PlanOut:    *cmd.planOut,
 		Recursive:  *cmd.recursive,
 		Sources:    sources,
+		Mounts:     mounts,
+		Symlinks:   symlinkPolicy(*cmd.symlinks),
+		Conflicts:  conflictPolicy(*cmd.conflicts),
+		Wait:       *cmd.wait,
 	}).Pull())
 }
 
 type pushCmd struct {
+	wait        *bool
+	conflicts   *string
+	symlinks    *string
+	jobs        *int
+	planOut     *string
+	strict      *bool
 	noClobber   *bool
 	hidden      *bool
 	force       *bool
@@ -246,6 +286,12 @@ func (cmd *pushCmd) Flags(fs *flag.FlagSet) *flag.FlagSet {
 	cmd.noPrompt = fs.Bool("no-prompt", false, "shows no prompt before applying the push action")
 	cmd.force = fs.Bool("force", false, "forces a push even if no changes present")
 	cmd.mountedPush = fs.Bool("m", false, "allows pushing of mounted paths")
+	cmd.strict = fs.Bool("strict", false, "fails uploads whose checksums don't match instead of re-uploading")
+	cmd.planOut = fs.String("plan-out", "", "saves the resolved changes to this path for `drive apply`")
+	cmd.jobs = fs.Int("j", drive.DefaultJobs, "maximum number of concurrent tasks")
+	cmd.symlinks = fs.String("symlinks", drive.SymlinksFollow, "policy for local symlinks: follow, skip or preserve")
+	cmd.conflicts = fs.String("conflicts", drive.ConflictReport, "policy for paths that are a folder on one side and a file on the other: report, rename or replace")
+	cmd.wait = fs.Bool("wait", false, "waits for the lock of the context to be released instead of failing")
 	return fs
 }
 
@@ -288,15 +334,73 @@ func (cmd *pushCmd) Run(args []string) {
 		exitWithError(drive.New(context, &drive.Options{
 			Force:     *cmd.force,
 			Hidden:    *cmd.hidden,
+			Jobs:      *cmd.jobs,
 			NoClobber: *cmd.noClobber,
 			NoPrompt:  *cmd.noPrompt,
 			Path:      path,
+			PlanOut:   *cmd.planOut,
 			Recursive: *cmd.recursive,
 			Sources:   sources,
+			Strict:    *cmd.strict,
+			Symlinks:  symlinkPolicy(*cmd.symlinks),
+			Conflicts: conflictPolicy(*cmd.conflicts),
+			Wait:      *cmd.wait,
 		}).Push())
 	}
 }
 
+type syncCmd struct {
+	wait       *bool
+	conflicts  *string
+	symlinks   *string
+	jobs       *int
+	strict     *bool
+	exportsDir *string
+	export     *string
+	hidden     *bool
+	noPrompt   *bool
+	noClobber  *bool
+	recursive  *bool
+}
+
+func (cmd *syncCmd) Flags(fs *flag.FlagSet) *flag.FlagSet {
+	cmd.noClobber = fs.Bool("no-clobber", false, "prevents overwriting of old content")
+	cmd.export = fs.String(
+		"export", "", "comma separated list of formats to export your docs + sheets files")
+	cmd.recursive = fs.Bool("r", true, "performs the sync action recursively")
+	cmd.noPrompt = fs.Bool("no-prompt", false, "shows no prompt before applying the sync action")
+	cmd.hidden = fs.Bool("hidden", false, "allows syncing of hidden paths")
+	cmd.exportsDir = fs.String("export-dir", "", "directory to place exports")
+	cmd.jobs = fs.Int("j", drive.DefaultJobs, "maximum number of concurrent tasks")
+	cmd.strict = fs.Bool("strict", false, "fails uploads whose checksums don't match instead of re-uploading")
+	cmd.symlinks = fs.String("symlinks", drive.SymlinksFollow, "policy for local symlinks: follow, skip or preserve")
+	cmd.conflicts = fs.String("conflicts", drive.ConflictReport, "policy for paths that are a folder on one side and a file on the other: report, rename or replace")
+	cmd.wait = fs.Bool("wait", false, "waits for the lock of the context to be released instead of failing")
+	return fs
+}
+
+func (cmd *syncCmd) Run(args []string) {
+	sources, context, path := preprocessArgs(args)
+
+	exports := nonEmptyStrings(strings.Split(*cmd.export, ","))
+
+	exitWithError(drive.New(context, &drive.Options{
+		Exports:    uniqOrderedStr(exports),
+		ExportsDir: strings.Trim(*cmd.exportsDir, " "),
+		Hidden:     *cmd.hidden,
+		Jobs:       *cmd.jobs,
+		NoPrompt:   *cmd.noPrompt,
+		NoClobber:  *cmd.noClobber,
+		Path:       path,
+		Recursive:  *cmd.recursive,
+		Sources:    sources,
+		Strict:     *cmd.strict,
+		Symlinks:   symlinkPolicy(*cmd.symlinks),
+		Conflicts:  conflictPolicy(*cmd.conflicts),
+		Wait:       *cmd.wait,
+	}).Sync())
+}
+
 type touchCmd struct {
 	hidden    *bool
 	noPrompt  *bool
@@ -344,23 +448,25 @@ func pushMounted(cmd *pushCmd, args []string) {
 
 	rest = nonEmptyStrings(rest)
 	context, path := discoverContext(contextArgs)
-	contextAbsPath, err := filepath.Abs(path)
 	if path == "." {
 		path = ""
 	}
-	exitWithError(err)
 
-	mountPoints, auxSrcs := config.MountPoints(path, contextAbsPath, rest, *cmd.hidden)
-	sources = append(sources, auxSrcs...)
+	mounts := config.MountPoints(context, path, rest, *cmd.hidden)
 
 	exitWithError(drive.New(context, &drive.Options{
 		Hidden:    *cmd.hidden,
+		Jobs:      *cmd.jobs,
 		NoPrompt:  *cmd.noPrompt,
 		Recursive: *cmd.recursive,
-		Mounts:    mountPoints,
+		Mounts:    mounts,
 		NoClobber: *cmd.noClobber,
 		Path:      path,
 		Sources:   sources,
+		Strict:    *cmd.strict,
+		Symlinks:  symlinkPolicy(*cmd.symlinks),
+		Conflicts: conflictPolicy(*cmd.conflicts),
+		Wait:      *cmd.wait,
 	}).Push())
 }
 
@@ -393,22 +499,289 @@ func (cmd *aboutCmd) Run(args []string) {
 	exitWithError(drive.New(context, &drive.Options{}).About(mask))
 }
 
+type applyCmd struct {
+	wait     *bool
+	jobs     *int
+	noPrompt *bool
+	strict   *bool
+}
+
+func (cmd *applyCmd) Flags(fs *flag.FlagSet) *flag.FlagSet {
+	cmd.noPrompt = fs.Bool("no-prompt", false, "shows no prompt before applying the plan")
+	cmd.strict = fs.Bool("strict", false, "fails uploads whose checksums don't match instead of re-uploading")
+	cmd.jobs = fs.Int("j", drive.DefaultJobs, "maximum number of concurrent tasks")
+	cmd.wait = fs.Bool("wait", false, "waits for the lock of the context to be released instead of failing")
+	return fs
+}
+
+func (cmd *applyCmd) Run(args []string) {
+	if len(args) != 1 {
+		exitWithError(fmt.Errorf("apply expects the path of exactly one plan"))
+	}
+	// The plan could live anywhere, the context is that of the working directory.
+	context, _ := discoverContext([]string{})
+	exitWithError(drive.New(context, &drive.Options{
+		Jobs:     *cmd.jobs,
+		NoPrompt: *cmd.noPrompt,
+		Strict:   *cmd.strict,
+		Wait:     *cmd.wait,
+	}).Apply(args[0]))
+}
+
+type logCmd struct {
+	since *string
+	until *string
+	ops   *string
+}
+
+func (cmd *logCmd) Flags(fs *flag.FlagSet) *flag.FlagSet {
+	cmd.since = fs.String("since", "", "only lists changes made on or after this date")
+	cmd.until = fs.String("until", "", "only lists changes made before this date")
+	cmd.ops = fs.String("op", "", "comma separated list of ops to list: add, delete, mod or chmod")
+	return fs
+}
+
+func (cmd *logCmd) Run(args []string) {
+	sources, context, path := preprocessArgs(args)
+	ops := nonEmptyStrings(strings.Split(*cmd.ops, ","))
+	for _, op := range ops {
+		exitWithError(drive.CheckOpName(op))
+	}
+	exitWithError(drive.New(context, &drive.Options{
+		Path:    path,
+		Sources: sources,
+	}).Log(parseLogTime(*cmd.since), parseLogTime(*cmd.until), ops))
+}
+
+type resumeCmd struct {
+	jobs     *int
+	noPrompt *bool
+	strict   *bool
+	wait     *bool
+}
+
+func (cmd *resumeCmd) Flags(fs *flag.FlagSet) *flag.FlagSet {
+	cmd.noPrompt = fs.Bool("no-prompt", false, "shows no prompt before applying the remaining changes")
+	cmd.strict = fs.Bool("strict", false, "fails uploads whose checksums don't match instead of re-uploading")
+	cmd.jobs = fs.Int("j", drive.DefaultJobs, "maximum number of concurrent tasks")
+	cmd.wait = fs.Bool("wait", false, "waits for the lock of the context to be released instead of failing")
+	return fs
+}
+
+func (cmd *resumeCmd) Run(args []string) {
+	context, _ := discoverContext([]string{})
+	exitWithError(drive.New(context, &drive.Options{
+		Jobs:     *cmd.jobs,
+		NoPrompt: *cmd.noPrompt,
+		Strict:   *cmd.strict,
+		Wait:     *cmd.wait,
+	}).Resume())
+}
+
+type checksumsCmd struct {
+	hidden  *bool
+	rebuild *bool
+}
+
+func (cmd *checksumsCmd) Flags(fs *flag.FlagSet) *flag.FlagSet {
+	cmd.hidden = fs.Bool("hidden", false, "includes hidden paths")
+	cmd.rebuild = fs.Bool("rebuild", false, "discards the cache and rehashes every file")
+	return fs
+}
+
+func (cmd *checksumsCmd) Run(args []string) {
+	sources, context, path := preprocessArgs(args)
+	g := drive.New(context, &drive.Options{
+		Hidden:  *cmd.hidden,
+		Path:    path,
+		Sources: sources,
+	})
+	if *cmd.rebuild {
+		exitWithError(g.RebuildChecksums())
+	} else {
+		exitWithError(g.VerifyChecksums())
+	}
+}
+
+const mountUsage = "usage: mount add <local_path> <remote_path> | list | remove <path>"
+
+type mountCmd struct{}
+
+func (cmd *mountCmd) Flags(fs *flag.FlagSet) *flag.FlagSet {
+	return fs
+}
+
+func (cmd *mountCmd) Run(args []string) {
+	if len(args) < 1 {
+		exitWithError(fmt.Errorf(mountUsage))
+	}
+	context, _ := discoverContext([]string{})
+	g := drive.New(context, &drive.Options{})
+
+	switch action, rest := args[0], args[1:]; {
+	case action == "add" && len(rest) == 2:
+		exitWithError(g.MountAdd(rest[0], rest[1]))
+	case action == "list" && len(rest) == 0:
+		exitWithError(g.MountList())
+	case action == "remove" && len(rest) == 1:
+		exitWithError(g.MountRemove(rest[0]))
+	default:
+		exitWithError(fmt.Errorf(mountUsage))
+	}
+}
+
+const sparseUsage = "usage: sparse add <path>... | list | remove <path>..."
+
+type sparseCmd struct {
+	noPrompt *bool
+	force    *bool
+	hidden   *bool
+	wait     *bool
+}
+
+func (cmd *sparseCmd) Flags(fs *flag.FlagSet) *flag.FlagSet {
+	cmd.noPrompt = fs.Bool("no-prompt", false, "shows no prompt before applying the pull action")
+	cmd.force = fs.Bool("force", false, "removes subtrees even with local changes that weren't pushed")
+	cmd.hidden = fs.Bool("hidden", false, "allows pulling of hidden paths")
+	cmd.wait = fs.Bool("wait", false, "waits for the lock of the context to be released instead of failing")
+	return fs
+}
+
+func (cmd *sparseCmd) Run(args []string) {
+	if len(args) < 1 {
+		exitWithError(fmt.Errorf(sparseUsage))
+	}
+	action, rest := args[0], args[1:]
+	if action == "list" && len(rest) == 0 {
+		context, _ := discoverContext([]string{})
+		exitWithError(drive.New(context, &drive.Options{}).SparseList())
+	}
+	if len(rest) < 1 {
+		exitWithError(fmt.Errorf(sparseUsage))
+	}
+	paths, context, path := preprocessArgs(rest)
+	g := drive.New(context, &drive.Options{
+		Force:     *cmd.force,
+		Hidden:    *cmd.hidden,
+		NoPrompt:  *cmd.noPrompt,
+		Path:      path,
+		Recursive: true,
+		Wait:      *cmd.wait,
+	})
+
+	switch action {
+	case "add":
+		exitWithError(g.SparseAdd(paths))
+	case "remove":
+		exitWithError(g.SparseRemove(paths))
+	default:
+		exitWithError(fmt.Errorf(sparseUsage))
+	}
+}
+
+type daemonCmd struct {
+	interval  *time.Duration
+	conflicts *string
+	symlinks  *string
+	jobs      *int
+	noClobber *bool
+	hidden    *bool
+}
+
+func (cmd *daemonCmd) Flags(fs *flag.FlagSet) *flag.FlagSet {
+	cmd.interval = fs.Duration("interval", drive.DefaultDaemonInterval, "time between two runs")
+	cmd.noClobber = fs.Bool("no-clobber", false, "prevents overwriting of old content")
+	cmd.hidden = fs.Bool("hidden", false, "allows syncing of hidden paths")
+	cmd.jobs = fs.Int("j", drive.DefaultJobs, "maximum number of concurrent tasks")
+	cmd.symlinks = fs.String("symlinks", drive.SymlinksFollow, "policy for local symlinks: follow, skip or preserve")
+	cmd.conflicts = fs.String("conflicts", drive.ConflictReport, "policy for paths that are a folder on one side and a file on the other: report, rename or replace")
+	return fs
+}
+
+func (cmd *daemonCmd) Run(args []string) {
+	sources, context, path := preprocessArgs(args)
+	exitWithError(drive.New(context, &drive.Options{
+		Hidden:    *cmd.hidden,
+		Interval:  *cmd.interval,
+		Jobs:      *cmd.jobs,
+		NoClobber: *cmd.noClobber,
+		NoPrompt:  true,
+		Path:      path,
+		Recursive: true,
+		Sources:   sources,
+		Symlinks:  symlinkPolicy(*cmd.symlinks),
+		Conflicts: conflictPolicy(*cmd.conflicts),
+	}).Daemon())
+}
+
+type watchCmd struct {
+	delay     *time.Duration
+	conflicts *string
+	symlinks  *string
+	jobs      *int
+	noClobber *bool
+	hidden    *bool
+}
+
+func (cmd *watchCmd) Flags(fs *flag.FlagSet) *flag.FlagSet {
+	cmd.delay = fs.Duration("delay", drive.DefaultWatchDelay, "time a changed path has to stay untouched before it's pushed")
+	cmd.noClobber = fs.Bool("no-clobber", false, "allows overwriting of old content")
+	cmd.hidden = fs.Bool("hidden", false, "allows pushing of hidden paths")
+	cmd.jobs = fs.Int("j", drive.DefaultJobs, "maximum number of concurrent tasks")
+	cmd.symlinks = fs.String("symlinks", drive.SymlinksFollow, "policy for local symlinks: follow, skip or preserve")
+	cmd.conflicts = fs.String("conflicts", drive.ConflictReport, "policy for paths that are a folder on one side and a file on the other: report, rename or replace")
+	return fs
+}
+
+func (cmd *watchCmd) Run(args []string) {
+	if *cmd.delay < drive.MinWatchDelay {
+		exitWithError(fmt.Errorf("-delay can't be shorter than %v", drive.MinWatchDelay))
+	}
+	sources, context, path := preprocessArgs(args)
+	exitWithError(drive.New(context, &drive.Options{
+		Delay:     *cmd.delay,
+		Hidden:    *cmd.hidden,
+		Jobs:      *cmd.jobs,
+		NoClobber: *cmd.noClobber,
+		NoPrompt:  true,
+		Path:      path,
+		Recursive: true,
+		Sources:   sources,
+		Symlinks:  symlinkPolicy(*cmd.symlinks),
+		Conflicts: conflictPolicy(*cmd.conflicts),
+		Wait:      true,
+	}).Watch())
+}
+
 type diffCmd struct {
-	hidden *bool
+	mounts   *string
+	symlinks *string
+	jobs     *int
+	hidden   *bool
 }
 
 func (cmd *diffCmd) Flags(fs *flag.FlagSet) *flag.FlagSet {
 	cmd.hidden = fs.Bool("hidden", false, "allows pulling of hidden paths")
+	cmd.jobs = fs.Int("j", drive.DefaultJobs, "maximum number of concurrent tasks")
+	cmd.symlinks = fs.String("symlinks", drive.SymlinksFollow, "policy for local symlinks: follow, skip or preserve")
+	cmd.mounts = fs.String("mount", "", "comma separated list of remote_path=local_path mounts outside of the context")
 	return fs
 }
 
 func (cmd *diffCmd) Run(args []string) {
 	sources, context, path := preprocessArgs(args)
+	mounts := parseMounts(context, *cmd.mounts)
+	if len(mounts) >= 1 && len(args) < 1 {
+		sources = nil
+	}
 	exitWithError(drive.New(context, &drive.Options{
+		Mounts:    mounts,
 		Recursive: true,
 		Path:      path,
 		Hidden:    *cmd.hidden,
+		Jobs:      *cmd.jobs,
 		Sources:   sources,
+		Symlinks:  symlinkPolicy(*cmd.symlinks),
 	}).Diff())
 }
 
@@ -450,11 +823,13 @@ func (cmd *emptyTrashCmd) Run(args []string) {
 }
 
 type trashCmd struct {
+	wait   *bool
 	hidden *bool
 }
 
 func (cmd *trashCmd) Flags(fs *flag.FlagSet) *flag.FlagSet {
 	cmd.hidden = fs.Bool("hidden", false, "allows trashing hidden paths")
+	cmd.wait = fs.Bool("wait", false, "waits for the lock of the context to be released instead of failing")
 	return fs
 }
 
@@ -463,15 +838,18 @@ func (cmd *trashCmd) Run(args []string) {
 	exitWithError(drive.New(context, &drive.Options{
 		Path:    path,
 		Sources: sources,
+		Wait:    *cmd.wait,
 	}).Trash())
 }
 
 type untrashCmd struct {
+	wait   *bool
 	hidden *bool
 }
 
 func (cmd *untrashCmd) Flags(fs *flag.FlagSet) *flag.FlagSet {
 	cmd.hidden = fs.Bool("hidden", false, "allows untrashing hidden paths")
+	cmd.wait = fs.Bool("wait", false, "waits for the lock of the context to be released instead of failing")
 	return fs
 }
 
@@ -480,6 +858,7 @@ func (cmd *untrashCmd) Run(args []string) {
 	exitWithError(drive.New(context, &drive.Options{
 		Path:    path,
 		Sources: sources,
+		Wait:    *cmd.wait,
 	}).Untrash())
 }
 
@@ -562,9 +941,58 @@ func uniqOrderedStr(sources []string) []string {
 	return uniqPaths
 }
 
+// parseMounts parses a comma separated list of remote_path=local_path
+// mounts, exiting if any of them is invalid.
+func parseMounts(context *config.Context, spec string) (mounts []*config.Mount) {
+	registered, err := context.Mounts()
+	exitWithError(err)
+
+	for _, pair := range nonEmptyStrings(strings.Split(spec, ",")) {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			exitWithError(fmt.Errorf("%q: expecting remote_path=local_path", pair))
+		}
+		m, mErr := context.NewMount(parts[1], parts[0])
+		exitWithError(mErr)
+		if other := m.Overlaps(append(registered, mounts...)); other != nil {
+			exitWithError(fmt.Errorf("%s overlaps the mount of %s", m.RemotePath, other.RemotePath))
+		}
+		mounts = append(mounts, m)
+	}
+	return
+}
+
+// parseLogTime parses a date, or a date and time, exiting if it's
+// invalid. An empty value gives the zero time.
+func parseLogTime(value string) time.Time {
+	if value == "" {
+		return time.Time{}
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		exitWithError(fmt.Errorf("%q: expecting a date such as 2015-06-01 or 2015-06-01T15:04:05Z", value))
+	}
+	return t
+}
+
+// symlinkPolicy exits if policy isn't a known symlink policy.
+func symlinkPolicy(policy string) string {
+	exitWithError(drive.CheckSymlinkPolicy(policy))
+	return policy
+}
+
+// conflictPolicy exits if policy isn't a known conflict policy.
+func conflictPolicy(policy string) string {
+	exitWithError(drive.CheckConflictPolicy(policy))
+	return policy
+}
+
 func exitWithError(err error) {
 	if err != nil {
-		fmt.Println(err)
+		drive.ReportError(err)
 		os.Exit(1)
 	}
 }
@@ -0,0 +1,211 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// maxStaleChecksums is the number of superseded lines the checksums
+// file can hold before it's compacted.
+const maxStaleChecksums = 1024
+
+// ChecksumCache persists the md5 checksums of local files in the .gd
+// directory. Entries are keyed by device, inode, size and modification
+// time so a file whose content could have changed never hits the cache.
+// New entries are appended as they are computed, replacing the entry of
+// the previous version of the file. The file is rewritten as a whole by
+// Reset, and compacted once it holds too many superseded lines.
+type ChecksumCache struct {
+	path string
+
+	mu      sync.Mutex
+	loaded  bool
+	entries map[string]string
+	// keys maps the identity of every file to its key in entries
+	keys map[string]string
+	// stale is the number of superseded lines in the file
+	stale int
+}
+
+func NewChecksumCache(contextAbsPath string) *ChecksumCache {
+	return &ChecksumCache{
+		path:    checksumsPath(contextAbsPath),
+		entries: map[string]string{},
+		keys:    map[string]string{},
+	}
+}
+
+// ChecksumKey returns the cache key of a local file,
+// or an empty string if it can't be keyed reliably.
+func ChecksumKey(info os.FileInfo) string {
+	if info == nil || info.IsDir() {
+		return ""
+	}
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || st == nil {
+		return ""
+	}
+	return fmt.Sprintf("%d:%d:%d:%d", st.Dev, st.Ino, info.Size(), info.ModTime().UnixNano())
+}
+
+// ChecksumIdentity returns the device and inode part of a checksum key,
+// which identifies a file across its versions.
+func ChecksumIdentity(key string) string {
+	parts := strings.SplitN(key, ":", 3)
+	if len(parts) < 3 {
+		return key
+	}
+	return parts[0] + ":" + parts[1]
+}
+
+// set records the checksum of key, dropping the entry of any other
+// version of the same file. It reports whether an entry was superseded.
+func (c *ChecksumCache) set(key, checksum string) (superseded bool) {
+	id := ChecksumIdentity(key)
+	if old, ok := c.keys[id]; ok {
+		delete(c.entries, old)
+		superseded = true
+	}
+	c.keys[id] = key
+	c.entries[key] = checksum
+	return
+}
+
+func (c *ChecksumCache) load() {
+	if c.loaded {
+		return
+	}
+	c.loaded = true
+
+	f, err := os.Open(c.path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			c.stale += 1
+			continue
+		}
+		// Later entries supersede earlier ones.
+		if c.set(fields[0], fields[1]) {
+			c.stale += 1
+		}
+	}
+	c.compactIfStale()
+}
+
+// compactIfStale rewrites the file with only the current entries once
+// it holds more superseded lines than maxStaleChecksums.
+func (c *ChecksumCache) compactIfStale() {
+	if c.stale <= maxStaleChecksums {
+		return
+	}
+	if err := c.write(c.entries); err == nil {
+		c.stale = 0
+	}
+}
+
+func (c *ChecksumCache) Get(key string) (checksum string, ok bool) {
+	if c == nil || key == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.load()
+	checksum, ok = c.entries[key]
+	return
+}
+
+func (c *ChecksumCache) Put(key, checksum string) (err error) {
+	if c == nil || key == "" || checksum == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.load()
+	if c.entries[key] == checksum {
+		return
+	}
+	if c.set(key, checksum) {
+		c.stale += 1
+	}
+
+	var f *os.File
+	f, err = os.OpenFile(c.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return
+	}
+	_, err = fmt.Fprintf(f, "%s %s\n", key, checksum)
+	if cErr := f.Close(); err == nil {
+		err = cErr
+	}
+	if err == nil {
+		c.compactIfStale()
+	}
+	return
+}
+
+// Reset replaces all the entries of the cache, compacting its file.
+func (c *ChecksumCache) Reset(entries map[string]string) (err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries, c.keys = map[string]string{}, map[string]string{}
+	for key, checksum := range entries {
+		c.set(key, checksum)
+	}
+	c.loaded = true
+	c.stale = 0
+	return c.write(c.entries)
+}
+
+func (c *ChecksumCache) write(entries map[string]string) (err error) {
+	var lines []string
+	for key, checksum := range entries {
+		lines = append(lines, fmt.Sprintf("%s %s\n", key, checksum))
+	}
+
+	return writeFileAtomic(c.path, []byte(strings.Join(lines, "")))
+}
+
+// Entries returns a copy of all the entries in the cache.
+func (c *ChecksumCache) Entries() map[string]string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.load()
+	entries := make(map[string]string, len(c.entries))
+	for key, checksum := range c.entries {
+		entries[key] = checksum
+	}
+	return entries
+}
+
+func checksumsPath(absPath string) string {
+	return path.Join(gdPath(absPath), "checksums")
+}
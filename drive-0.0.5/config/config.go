@@ -21,8 +21,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
-	"path/filepath"
-	"strings"
+	"sync"
 )
 
 type Context struct {
@@ -30,29 +29,43 @@ type Context struct {
 	ClientSecret string `json:"client_secret"`
 	RefreshToken string `json:"refresh_token"`
 	AbsPath      string `json:"-"`
+
+	ignoreOnce sync.Once
+	ignorer    *Ignorer
+
+	namesOnce sync.Once
+	names     *NameMap
 }
 
-type MountPoint struct {
-	CanClean  bool
-	Name      string
-	AbsPath   string
-	MountPath string
+func (c *Context) AbsPathOf(fileOrDirPath string) string {
+	return path.Join(c.AbsPath, fileOrDirPath)
 }
 
-func (mpt *MountPoint) mounted() bool {
-	// TODO: Find proper scheme for resolving symlinks
-	return mpt.CanClean
+// Ignored reports whether the .driveignore rules of the context
+// exclude relPath, a path relative to the context root.
+func (c *Context) Ignored(relPath string, isDir bool) bool {
+	c.ignoreOnce.Do(func() {
+		c.ignorer = NewIgnorer(c.AbsPath)
+	})
+	return c.ignorer.Ignored(relPath, isDir)
 }
 
-func (mpt *MountPoint) Unmount() error {
-	if mpt.mounted() {
-		return os.RemoveAll(mpt.MountPath)
-	}
-	return nil
+// RefreshIgnored makes the next calls to Ignored follow the changes
+// made to .driveignore files since they were read.
+func (c *Context) RefreshIgnored() {
+	c.ignoreOnce.Do(func() {
+		c.ignorer = NewIgnorer(c.AbsPath)
+	})
+	c.ignorer.Refresh()
 }
 
-func (c *Context) AbsPathOf(fileOrDirPath string) string {
-	return path.Join(c.AbsPath, fileOrDirPath)
+// Names returns the map of the Drive titles of local paths whose names
+// differ from their titles.
+func (c *Context) Names() *NameMap {
+	c.namesOnce.Do(func() {
+		c.names = NewNameMap(c.AbsPath)
+	})
+	return c.names
 }
 
 func (c *Context) Read() (err error) {
@@ -120,6 +133,16 @@ func Initialize(absPath string) (pathGD string, firstInit bool, c *Context, err
 	return
 }
 
+// writeFileAtomic replaces the file at p with data, writing it to a
+// temporary file first so that p is never left half written.
+func writeFileAtomic(p string, data []byte) (err error) {
+	tmpPath := p + ".tmp"
+	if err = ioutil.WriteFile(tmpPath, data, 0600); err != nil {
+		return
+	}
+	return os.Rename(tmpPath, p)
+}
+
 func gdPath(absPath string) string {
 	return path.Join(absPath, ".gd")
 }
@@ -127,54 +150,3 @@ func gdPath(absPath string) string {
 func credentialsPath(absPath string) string {
 	return path.Join(gdPath(absPath), "credentials.json")
 }
-
-func MountPoints(contextPath, contextAbsPath string, paths []string, hidden bool) (
-	mtPoints []*MountPoint, sources []string) {
-	visitors := map[string]bool{}
-
-	for _, path := range paths {
-		_, visited := visitors[path]
-		if visited {
-			continue
-		}
-		visitors[path] = true
-
-		localinfo, err := os.Stat(path)
-		if err != nil || localinfo == nil {
-			continue
-		}
-
-		base := filepath.Base(path)
-		if !hidden && strings.HasPrefix(base, ".") {
-			continue
-		}
-
-		canClean := true
-		mountPath := filepath.Join(contextAbsPath, base)
-		err = os.Symlink(path, mountPath)
-
-		if err != nil {
-			if !os.IsExist(err) {
-				continue
-			}
-			// This is an old symlink with probably due to a name clash.
-			// TODO: Due to the name clash, find a good name for this symlink.
-			canClean = false
-		}
-
-		var relPath = ""
-		if contextPath == "" {
-			relPath = strings.Join([]string{"", base}, "/")
-		} else {
-			relPath = strings.Join([]string{"", contextPath, base}, "/")
-		}
-
-		mtPoints = append(mtPoints, &MountPoint{
-			AbsPath:   path,
-			CanClean:  canClean,
-			MountPath: mountPath,
-			Name:      relPath,
-		})
-	}
-	return
-}
@@ -0,0 +1,240 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const IgnoreFileName = ".driveignore"
+
+type ignoreRule struct {
+	negate   bool
+	dirOnly  bool
+	anchored bool
+	regex    *regexp.Regexp
+}
+
+// Ignorer matches paths relative to a drive context against the
+// gitignore-style patterns of the .driveignore files found in the
+// context root and in any of its subdirectories.
+type Ignorer struct {
+	absPath string
+
+	mu    sync.Mutex
+	rules map[string]*ignoreFile
+}
+
+// ignoreFile holds the rules of a .driveignore file along with the
+// modification time they were read at, zero if there's no such file.
+type ignoreFile struct {
+	rules   []*ignoreRule
+	modTime time.Time
+}
+
+func NewIgnorer(contextAbsPath string) *Ignorer {
+	return &Ignorer{
+		absPath: contextAbsPath,
+		rules:   map[string]*ignoreFile{},
+	}
+}
+
+// Refresh drops the cached rules of every .driveignore file that was
+// created, modified or removed since it was read, for long running
+// commands to follow rule changes.
+func (ig *Ignorer) Refresh() {
+	if ig == nil {
+		return
+	}
+	ig.mu.Lock()
+	defer ig.mu.Unlock()
+
+	for relDir, cached := range ig.rules {
+		if !ignoreModTime(ig.ignorePath(relDir)).Equal(cached.modTime) {
+			delete(ig.rules, relDir)
+		}
+	}
+}
+
+func (ig *Ignorer) ignorePath(relDir string) string {
+	return path.Join(ig.absPath, relDir, IgnoreFileName)
+}
+
+func ignoreModTime(p string) time.Time {
+	info, err := os.Stat(p)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// Ignored reports whether relPath, a '/' separated path relative to the
+// context root, is excluded by any .driveignore file. As with gitignore,
+// the content of an excluded directory is excluded and can't be re-included.
+func (ig *Ignorer) Ignored(relPath string, isDir bool) bool {
+	if ig == nil {
+		return false
+	}
+	relPath = strings.Trim(path.Clean("/"+relPath), "/")
+	if relPath == "" {
+		return false
+	}
+
+	parts := strings.Split(relPath, "/")
+	for i := range parts {
+		last := i == len(parts)-1
+		if ig.matches(parts[:i], parts[i], isDir || !last) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches applies, from the context root down, the rules of every
+// .driveignore file in dirParts to name. Deeper and later rules win.
+func (ig *Ignorer) matches(dirParts []string, name string, isDir bool) bool {
+	ignored := false
+	for i := 0; i <= len(dirParts); i++ {
+		base := strings.Join(dirParts[:i], "/")
+		rel := strings.Join(append(append([]string{}, dirParts[i:]...), name), "/")
+		for _, rule := range ig.rulesIn(base) {
+			if rule.dirOnly && !isDir {
+				continue
+			}
+			subject := name
+			if rule.anchored {
+				subject = rel
+			}
+			if rule.regex.MatchString(subject) {
+				ignored = !rule.negate
+			}
+		}
+	}
+	return ignored
+}
+
+func (ig *Ignorer) rulesIn(relDir string) []*ignoreRule {
+	ig.mu.Lock()
+	defer ig.mu.Unlock()
+
+	cached, ok := ig.rules[relDir]
+	if !ok {
+		p := ig.ignorePath(relDir)
+		// The time is taken first, for a change made while
+		// reading the file to be caught by Refresh.
+		cached = &ignoreFile{modTime: ignoreModTime(p)}
+		cached.rules = readIgnoreFile(p)
+		ig.rules[relDir] = cached
+	}
+	return cached.rules
+}
+
+func readIgnoreFile(p string) (rules []*ignoreRule) {
+	f, err := os.Open(p)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if rule := parseIgnoreRule(scanner.Text()); rule != nil {
+			rules = append(rules, rule)
+		}
+	}
+	return
+}
+
+func parseIgnoreRule(line string) *ignoreRule {
+	line = strings.TrimRight(line, "\r")
+	if !strings.HasSuffix(line, "\\ ") {
+		line = strings.TrimRight(line, " \t")
+	}
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil
+	}
+
+	rule := &ignoreRule{}
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, "\\!") || strings.HasPrefix(line, "\\#") {
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if strings.Contains(line, "/") {
+		rule.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+	if line == "" {
+		return nil
+	}
+
+	regex, err := regexp.Compile("^" + globToRegexp(line) + "$")
+	if err != nil {
+		return nil
+	}
+	rule.regex = regex
+	return rule
+}
+
+// globToRegexp translates a gitignore glob into a regular expression.
+// '*' and '?' never match a '/', while '**' matches across directories.
+func globToRegexp(glob string) string {
+	var buf []string
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			buf = append(buf, "(.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			buf = append(buf, ".*")
+			i += 1
+		case c == '*':
+			buf = append(buf, "[^/]*")
+		case c == '?':
+			buf = append(buf, "[^/]")
+		case c == '\\' && i+1 < len(glob):
+			i += 1
+			buf = append(buf, regexp.QuoteMeta(glob[i:i+1]))
+		case c == '[':
+			end := strings.Index(glob[i:], "]")
+			if end < 0 {
+				buf = append(buf, "\\[")
+				continue
+			}
+			class := glob[i+1 : i+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			buf = append(buf, "["+class+"]")
+			i += end
+		default:
+			buf = append(buf, regexp.QuoteMeta(string(c)))
+		}
+	}
+	return strings.Join(buf, "")
+}
@@ -0,0 +1,179 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"syscall"
+	"time"
+)
+
+// LockPollInterval is how often a held lock is checked while waiting for it.
+const LockPollInterval = time.Second
+
+// Lock is the advisory lock of a context, held by a command that modifies it.
+type Lock struct {
+	Command string    `json:"command"`
+	Pid     int       `json:"pid"`
+	Host    string    `json:"host"`
+	Since   time.Time `json:"since"`
+
+	path string
+}
+
+// LockedError is returned when the lock is held by another process.
+type LockedError struct {
+	Holder *Lock
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("context locked by `%s` (pid %d on %s) since %s, use -wait to wait for it",
+		e.Holder.Command, e.Holder.Pid, e.Holder.Host, e.Holder.Since.Format(time.RFC3339))
+}
+
+// Lock takes the lock of the context for command. A lock left behind by a
+// process of this host that no longer runs is taken over. If the lock is held,
+// a LockedError is returned unless wait is set, in which case Lock blocks
+// until the lock is released.
+func (c *Context) Lock(command string, wait bool) (l *Lock, err error) {
+	host, _ := os.Hostname()
+	l = &Lock{
+		Command: command,
+		Pid:     os.Getpid(),
+		Host:    host,
+		path:    lockPath(c.AbsPath),
+	}
+	waiting := false
+	for {
+		l.Since = time.Now()
+		if err = l.create(); !os.IsExist(err) {
+			return
+		}
+		var holder *Lock
+		if holder, err = takeOver(l.path, host); err != nil {
+			return nil, err
+		}
+		if holder == nil {
+			// The holder is gone, or released the lock meanwhile.
+			continue
+		}
+		if !wait {
+			return nil, &LockedError{Holder: holder}
+		}
+		if !waiting {
+			fmt.Fprintf(os.Stderr, "Waiting for `%s` (pid %d on %s) to finish\n", holder.Command, holder.Pid, holder.Host)
+			waiting = true
+		}
+		time.Sleep(LockPollInterval)
+	}
+}
+
+// takeOver removes the lock at lockPath if its holder is a process of host
+// that doesn't run anymore, and returns the holder otherwise, nil if there's
+// none. The lock is read and removed under an exclusive flock of a companion
+// file: two processes finding the same stale lock would otherwise both remove
+// it, the second one removing the lock the first created meanwhile.
+func takeOver(lockPath, host string) (holder *Lock, err error) {
+	var f *os.File
+	if f, err = os.OpenFile(lockPath+".takeover", os.O_CREATE|os.O_RDWR, 0600); err != nil {
+		return
+	}
+	defer f.Close()
+	if err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		return
+	}
+	defer syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+
+	if holder, err = readLock(lockPath); err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+	if holder != nil && !holder.stale(host) {
+		return
+	}
+	if err = os.Remove(lockPath); os.IsNotExist(err) {
+		err = nil
+	}
+	return nil, err
+}
+
+// Unlock releases the lock.
+func (l *Lock) Unlock() error {
+	return os.Remove(l.path)
+}
+
+func (l *Lock) create() error {
+	data, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(data); err != nil {
+		f.Close()
+		os.Remove(l.path)
+		return err
+	}
+	return f.Close()
+}
+
+// stale reports whether the holder of the lock is a process of host that
+// doesn't run anymore. The holder of a lock taken on another host, one
+// sharing the context over a network file system, can't be checked for.
+func (l *Lock) stale(host string) bool {
+	if l.Host != host {
+		return false
+	}
+	p, err := os.FindProcess(l.Pid)
+	if err != nil {
+		return true
+	}
+	err = p.Signal(syscall.Signal(0))
+	return err != nil && err != syscall.EPERM
+}
+
+// readLock returns the holder of the lock at lockPath, nil if the
+// lock is being written or was left half written by a crash.
+func readLock(lockPath string) (l *Lock, err error) {
+	var data []byte
+	var info os.FileInfo
+	if info, err = os.Stat(lockPath); err != nil {
+		return
+	}
+	if data, err = ioutil.ReadFile(lockPath); err != nil {
+		return
+	}
+	l = &Lock{}
+	if jErr := json.Unmarshal(data, l); jErr != nil {
+		if time.Since(info.ModTime()) < LockPollInterval {
+			// Most likely still being written, check again later.
+			return &Lock{Command: "?", Since: info.ModTime()}, nil
+		}
+		return nil, nil
+	}
+	return
+}
+
+func lockPath(absPath string) string {
+	return path.Join(gdPath(absPath), "lock")
+}
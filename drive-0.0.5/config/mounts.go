@@ -0,0 +1,204 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Mount maps a remote path to a local directory or file
+// outside of the context, in place of the context's own tree.
+type Mount struct {
+	LocalPath  string `json:"local_path"`
+	RemotePath string `json:"remote_path"`
+}
+
+// LocalPathOf returns the local path of p, a remote path
+// that is the mount's remote path or one below it.
+func (m *Mount) LocalPathOf(p string) string {
+	return filepath.Join(m.LocalPath, strings.TrimPrefix(p, m.RemotePath))
+}
+
+// IsUnder reports whether p is parent or a path below it.
+func IsUnder(p, parent string) bool {
+	if parent == "/" {
+		return strings.HasPrefix(p, "/")
+	}
+	return p == parent || strings.HasPrefix(p, parent+"/")
+}
+
+// FindMount returns the mount p is in, if any.
+func FindMount(mounts []*Mount, p string) *Mount {
+	var found *Mount
+	for _, m := range mounts {
+		if !IsUnder(p, m.RemotePath) {
+			continue
+		}
+		if found == nil || len(m.RemotePath) > len(found.RemotePath) {
+			found = m
+		}
+	}
+	return found
+}
+
+// Mounts returns the mounts registered in the context.
+func (c *Context) Mounts() (mounts []*Mount, err error) {
+	var data []byte
+	if data, err = ioutil.ReadFile(mountsPath(c.AbsPath)); err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+	err = json.Unmarshal(data, &mounts)
+	return
+}
+
+func (c *Context) writeMounts(mounts []*Mount) (err error) {
+	var data []byte
+	if data, err = json.MarshalIndent(mounts, "", "  "); err != nil {
+		return
+	}
+	return writeFileAtomic(mountsPath(c.AbsPath), data)
+}
+
+// NewMount checks that localPath can be the local side of remotePath and
+// returns their mount. localPath has to be outside of the context, and
+// if it doesn't exist yet its parent directory has to.
+func (c *Context) NewMount(localPath, remotePath string) (m *Mount, err error) {
+	if localPath, err = filepath.Abs(localPath); err != nil {
+		return
+	}
+	if _, err = os.Stat(localPath); err != nil {
+		if !os.IsNotExist(err) {
+			return
+		}
+		if _, err = os.Stat(filepath.Dir(localPath)); err != nil {
+			return
+		}
+	}
+	if IsUnder(localPath, c.AbsPath) || IsUnder(c.AbsPath, localPath) {
+		return nil, fmt.Errorf("%s overlaps the context %s", localPath, c.AbsPath)
+	}
+	remotePath = path.Clean(path.Join("/", remotePath))
+	if remotePath == "/" {
+		return nil, fmt.Errorf("the remote root can't be mounted")
+	}
+	return &Mount{LocalPath: localPath, RemotePath: remotePath}, nil
+}
+
+// Overlaps returns the first of mounts whose remote path is m's or is
+// above or below it.
+func (m *Mount) Overlaps(mounts []*Mount) *Mount {
+	for _, other := range mounts {
+		if IsUnder(m.RemotePath, other.RemotePath) || IsUnder(other.RemotePath, m.RemotePath) {
+			return other
+		}
+	}
+	return nil
+}
+
+// AddMount registers localPath, an existing path outside of the context,
+// as the local side of remotePath.
+func (c *Context) AddMount(localPath, remotePath string) (m *Mount, err error) {
+	if m, err = c.NewMount(localPath, remotePath); err != nil {
+		return
+	}
+	if _, err = os.Stat(m.LocalPath); err != nil {
+		return nil, err
+	}
+
+	var mounts []*Mount
+	if mounts, err = c.Mounts(); err != nil {
+		return
+	}
+	if other := m.Overlaps(mounts); other != nil {
+		return nil, fmt.Errorf("%s overlaps the mount of %s", m.RemotePath, other.RemotePath)
+	}
+	err = c.writeMounts(append(mounts, m))
+	return
+}
+
+// RemoveMount unregisters the mount whose remote or local path is p.
+// The local files are left alone.
+func (c *Context) RemoveMount(p string) (m *Mount, err error) {
+	var mounts []*Mount
+	if mounts, err = c.Mounts(); err != nil {
+		return
+	}
+	absPath, _ := filepath.Abs(p)
+	remotePath := path.Clean(path.Join("/", p))
+
+	var kept []*Mount
+	for _, other := range mounts {
+		if m == nil && (other.RemotePath == remotePath || other.LocalPath == absPath) {
+			m = other
+			continue
+		}
+		kept = append(kept, other)
+	}
+	if m == nil {
+		return nil, fmt.Errorf("%s is not mounted", p)
+	}
+	err = c.writeMounts(kept)
+	return
+}
+
+// MountPoints returns mounts of the local paths under contextPath, a path
+// relative to the root of context, named after their base names. Hidden
+// paths and those ignored by the .driveignore rules of context are left out.
+func MountPoints(context *Context, contextPath string, paths []string, hidden bool) (mounts []*Mount) {
+	visitors := map[string]bool{}
+
+	for _, p := range paths {
+		if visitors[p] {
+			continue
+		}
+		visitors[p] = true
+
+		absPath, err := filepath.Abs(p)
+		if err != nil {
+			continue
+		}
+		localinfo, err := os.Stat(absPath)
+		if err != nil || localinfo == nil {
+			continue
+		}
+
+		base := filepath.Base(absPath)
+		if !hidden && strings.HasPrefix(base, ".") {
+			continue
+		}
+		if context.Ignored(path.Join(contextPath, base), localinfo.IsDir()) {
+			continue
+		}
+
+		mounts = append(mounts, &Mount{
+			LocalPath:  absPath,
+			RemotePath: path.Join("/", contextPath, base),
+		})
+	}
+	return
+}
+
+func mountsPath(absPath string) string {
+	return path.Join(gdPath(absPath), "mounts.json")
+}
@@ -0,0 +1,86 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path"
+	"sync"
+)
+
+// NameMap persists the Drive titles of local paths whose names had
+// to be changed to exist on disk, so they can be pushed back under
+// their original titles. It is stored in the .gd directory.
+type NameMap struct {
+	path string
+
+	mu     sync.Mutex
+	loaded bool
+	titles map[string]string
+}
+
+func NewNameMap(contextAbsPath string) *NameMap {
+	return &NameMap{
+		path:   namesPath(contextAbsPath),
+		titles: map[string]string{},
+	}
+}
+
+func (m *NameMap) load() {
+	if m.loaded {
+		return
+	}
+	m.loaded = true
+
+	data, err := ioutil.ReadFile(m.path)
+	if err != nil {
+		return
+	}
+	json.Unmarshal(data, &m.titles)
+}
+
+// Title returns the Drive title of the local path relPath,
+// a path relative to the context root.
+func (m *NameMap) Title(relPath string) (title string, ok bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.load()
+	title, ok = m.titles[relPath]
+	return
+}
+
+// Put records title as the Drive title of the local path relPath.
+func (m *NameMap) Put(relPath, title string) (err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.load()
+	if prev, ok := m.titles[relPath]; ok && prev == title {
+		return
+	}
+	m.titles[relPath] = title
+
+	var data []byte
+	if data, err = json.MarshalIndent(m.titles, "", "  "); err != nil {
+		return
+	}
+	return writeFileAtomic(m.path, data)
+}
+
+func namesPath(absPath string) string {
+	return path.Join(gdPath(absPath), "names.json")
+}
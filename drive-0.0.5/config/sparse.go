@@ -0,0 +1,79 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+)
+
+// SparsePaths returns the remote subtrees tracked by the context, one per
+// line of the .gd/sparse file. An empty list tracks the whole drive.
+func (c *Context) SparsePaths() (paths []string, err error) {
+	var data []byte
+	if data, err = ioutil.ReadFile(sparsePath(c.AbsPath)); err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		paths = append(paths, path.Clean(path.Join("/", line)))
+	}
+	return
+}
+
+// SetSparsePaths replaces the remote subtrees tracked by the context.
+func (c *Context) SetSparsePaths(paths []string) (err error) {
+	var data string
+	for _, p := range paths {
+		data += p + "\n"
+	}
+	return writeFileAtomic(sparsePath(c.AbsPath), []byte(data))
+}
+
+// InSparse reports whether p is in one of the subtrees of paths,
+// always true if paths is empty.
+func InSparse(paths []string, p string) bool {
+	if len(paths) < 1 {
+		return true
+	}
+	for _, included := range paths {
+		if IsUnder(p, included) {
+			return true
+		}
+	}
+	return false
+}
+
+// SparseAncestor reports whether p leads to one of the subtrees of paths.
+func SparseAncestor(paths []string, p string) bool {
+	for _, included := range paths {
+		if included != p && IsUnder(included, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func sparsePath(absPath string) string {
+	return path.Join(gdPath(absPath), "sparse")
+}
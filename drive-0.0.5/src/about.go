@@ -64,6 +64,10 @@ func featuresRequested(mask int) bool {
 }
 
 func printSummary(about *drive.About, mask int) {
+	if OutputJSON {
+		emitSummary(about, mask)
+		return
+	}
 	if quotaRequested(mask) {
 		quotaInformation(about)
 	}
@@ -126,6 +130,40 @@ func quotaInformation(about *drive.About) {
 	fmt.Println()
 }
 
+func emitSummary(about *drive.About, mask int) {
+	if quotaRequested(mask) {
+		rec := &quotaRecord{
+			Type:           "quota",
+			Name:           about.Name,
+			AccountType:    about.QuotaType,
+			BytesUsed:      about.QuotaBytesUsed,
+			BytesFree:      about.QuotaBytesTotal - about.QuotaBytesUsed,
+			BytesInTrash:   about.QuotaBytesUsedInTrash,
+			BytesTotal:     about.QuotaBytesTotal,
+			BytesAggregate: about.QuotaBytesUsedAggregate,
+		}
+		for _, quotaService := range about.QuotaBytesByService {
+			rec.Services = append(rec.Services, &serviceQuota{
+				Name: quotaService.ServiceName, BytesUsed: quotaService.BytesUsed,
+			})
+		}
+		emit(rec)
+	}
+	if fileSizesRequested(mask) {
+		for _, uploadInfo := range about.MaxUploadSizes {
+			emit(&uploadSizeRecord{Type: "max_upload_size", FileType: uploadInfo.Type, Size: uploadInfo.Size})
+		}
+	}
+	if featuresRequested(mask) {
+		for _, feature := range about.Features {
+			if feature.FeatureName == "" {
+				continue
+			}
+			emit(&featureRecord{Type: "feature", Name: feature.FeatureName, Rate: feature.FeatureRate})
+		}
+	}
+}
+
 func (g *Commands) QuotaStatus(query int64) (status int, err error) {
 	if query < 0 {
 		return Unknown, err
@@ -17,6 +17,7 @@ package drive
 import (
 	"fmt"
 	"os"
+	gopath "path"
 	"path/filepath"
 	"strings"
 	"sync"
@@ -27,11 +28,13 @@ type dirList struct {
 	local  *File
 }
 
+// Name returns the name of the listed path, that of the local file if
+// there is one since the remote name may only match it once normalized.
 func (d *dirList) Name() string {
-	if d.remote != nil {
-		return d.remote.Name
+	if d.local != nil {
+		return d.local.Name
 	}
-	return d.local.Name
+	return d.remote.Name
 }
 
 type sizeCounter struct {
@@ -93,21 +96,34 @@ func (g *Commands) changeListResolve(relToRoot, fsPath string, isPush bool) (cl
 	localinfo, _ := os.Stat(fsPath)
 	if localinfo != nil {
 		l = NewLocalFile(fsPath, localinfo)
+		l.Title = remoteTitle(g.context, relToRoot, l.Name)
 	}
 
-	fmt.Println("Resolving...")
-	cl, err = g.resolveChangeListRecv(isPush, relToRoot, relToRoot, r, l)
+	var parentId string
+	if isPush {
+		parentId = g.remoteParentId(relToRoot)
+	}
+
+	logf("Resolving...\n")
+	cl, err = g.resolveChangeListRecv(isPush, relToRoot, relToRoot, parentId, r, l)
 	return
 }
 
-func (g *Commands) clearMountPoints() {
-	for _, mtpt := range g.opts.Mounts {
-		mtpt.Unmount()
+// remoteParentId returns the id of the remote parent folder of p,
+// or an empty string if it doesn't exist.
+func (g *Commands) remoteParentId(p string) string {
+	if p == "/" || p == "" {
+		return ""
 	}
+	parent, err := g.rem.FindByPath(gopath.Dir(p))
+	if err != nil || parent == nil {
+		return ""
+	}
+	return parent.Id
 }
 
 func (g *Commands) resolveChangeListRecv(
-	isPush bool, d, p string, r *File, l *File) (cl []*Change, err error) {
+	isPush bool, d, p, parentId string, r *File, l *File) (cl []*Change, err error) {
 	var change *Change
 	if isPush {
 		// Handle the case of doc files for which we don't have a direct download
@@ -128,9 +144,16 @@ func (g *Commands) resolveChangeListRecv(
 		change = &Change{Path: p, Src: r, Dest: l, Parent: d}
 	}
 
+	change.ParentId = parentId
 	change.Force = g.opts.Force
 	change.NoClobber = g.opts.NoClobber
 
+	// The destination is deleted or renamed aside before the source
+	// is copied over, see splitTypeChange.
+	if typesConflict(r, l) && g.skipTypeConflict(change, r, l) {
+		return cl, nil
+	}
+
 	if change.Op() != OpNone {
 		cl = append(cl, change)
 	}
@@ -138,7 +161,6 @@ func (g *Commands) resolveChangeListRecv(
 		return cl, nil
 	}
 
-	// TODO: handle cases where remote and local type don't match
 	if !isPush && r != nil && !r.IsDir {
 		return cl, nil
 	}
@@ -146,87 +168,133 @@ func (g *Commands) resolveChangeListRecv(
 		return cl, nil
 	}
 
-	// look-up for children
+	// look-up for children, a side that is an ordinary file has none
+	// even if the other side is a directory.
 	var localChildren []*File
-	if l != nil {
-		localChildren, err = list(g.context, p, g.opts.Hidden)
+	if l != nil && l.IsDir {
+		localChildren, err = g.list(p)
 		if err != nil {
 			return
 		}
 	}
 
 	var remoteChildren []*File
-	if r != nil {
-		remoteChildren, err = g.rem.FindByParentId(r.Id, g.opts.Hidden)
+	if r != nil && r.IsDir {
+		remoteChildren, err = g.rem.FindByParentId(r.Id, p, g.opts.Hidden)
 		if err != nil {
 			return
 		}
 	}
 	dirlist := merge(remoteChildren, localChildren)
 
-	// Arbitrary value. TODO: Calibrate or calculate this value
-	chunkSize := 100
-	srcLen := len(dirlist)
-	chunkCount, remainder := srcLen/chunkSize, srcLen%chunkSize
-	i := 0
-
-	if remainder != 0 {
-		chunkCount += 1
+	// Children of a folder that doesn't exist remotely are linked
+	// to the change creating it just before they're pushed.
+	childParentId := ""
+	if r != nil && r.IsDir {
+		childParentId = r.Id
 	}
 
-	var wg sync.WaitGroup
-	wg.Add(chunkCount)
-	for j := 0; j < chunkCount; j += 1 {
-		end := i + chunkSize
-		if end >= srcLen {
-			end = srcLen
+	// Children are resolved by idle workers when any are available, the
+	// results are collected by index to keep the output order deterministic.
+	childChanges := make([][]*Change, len(dirlist))
+	childErrs := make([]error, len(dirlist))
+	g.resolveConcurrently(len(dirlist), func(i int) {
+		l := dirlist[i]
+		// Avoiding path.Join which normalizes '/+' to '/'
+		var joined string
+		if p == "/" {
+			joined = "/" + l.Name()
+		} else {
+			joined = strings.Join([]string{p, l.Name()}, "/")
+		}
+		if g.skipMounted(joined, isPush, l.local != nil) {
+			return
+		}
+		if g.skipSparse(joined, isPush, l.local != nil, l.remote != nil) {
+			return
 		}
+		childChanges[i], childErrs[i] = g.resolveChangeListRecv(isPush, p, joined, childParentId, l.remote, l.local)
+	})
 
-		go func(wg *sync.WaitGroup, isPush bool, cl *[]*Change, p string, dlist []*dirList) {
-			defer wg.Done()
-			for _, l := range dlist {
-				// Avoiding path.Join which normalizes '/+' to '/'
-				var joined string
-				if p == "/" {
-					joined = "/" + l.Name()
-				} else {
-					joined = strings.Join([]string{p, l.Name()}, "/")
-				}
-				childChanges, _ := g.resolveChangeListRecv(isPush, p, joined, l.remote, l.local)
-				*cl = append(*cl, childChanges...)
-			}
-		}(&wg, isPush, &cl, p, dirlist[i:end])
+	for i, ccl := range childChanges {
+		if childErrs[i] != nil {
+			return cl, childErrs[i]
+		}
+		cl = append(cl, ccl...)
+	}
+	return cl, nil
+}
 
-		i += chunkSize
+// resolveConcurrently calls fn for every index in [0, n). A call is handed
+// to an idle resolver worker if there is one, otherwise it runs inline on
+// the calling goroutine. Since a caller never blocks waiting for a worker,
+// nested calls can't deadlock and at most Options.Jobs calls run at once.
+func (g *Commands) resolveConcurrently(n int, fn func(i int)) {
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		select {
+		case g.resolvers <- struct{}{}:
+			wg.Add(1)
+			go func(i int) {
+				defer func() {
+					<-g.resolvers
+					wg.Done()
+				}()
+				fn(i)
+			}(i)
+		default:
+			fn(i)
+		}
 	}
 	wg.Wait()
-	return cl, nil
 }
 
 func merge(remotes, locals []*File) (merged []*dirList) {
+	// Names are matched once normalized, so that the same name
+	// encoded differently on either side is the same file. Local files
+	// whose names localName wouldn't produce, such as ones created with
+	// a percent sign, are matched by the title they were pushed with.
 	localMap := map[string]*File{}
+	titleMap := map[string]*File{}
 
 	// Add support for FileSystems that allow same names but different files.
 
 	for _, l := range locals {
-		localMap[l.Name] = l
+		key := normalizedName(l.Name)
+		if _, dup := localMap[key]; !dup {
+			localMap[key] = l
+		}
+		if l.Title == "" {
+			continue
+		}
+		key = normalizedName(l.Title)
+		if _, dup := titleMap[key]; !dup {
+			titleMap[key] = l
+		}
 	}
 
+	matched := map[*File]bool{}
 	for _, r := range remotes {
 		list := &dirList{remote: r}
 
 		// look for local
-		l, ok := localMap[r.Name]
-		if ok {
+		l, ok := localMap[normalizedName(r.Name)]
+		if !ok || matched[l] {
+			l, ok = titleMap[normalizedName(r.Title)]
+		}
+		if ok && !matched[l] {
 			list.local = l
-			delete(localMap, r.Name)
+			matched[l] = true
 		}
 		merged = append(merged, list)
 	}
 
 	// if anything left in locals, add to the dir listing
-	for _, l := range localMap {
-		merged = append(merged, &dirList{local: l})
+	// in their listing order to keep the merge deterministic.
+	for _, l := range locals {
+		if !matched[l] {
+			merged = append(merged, &dirList{local: l})
+		}
 	}
 	return
 }
@@ -234,6 +302,10 @@ func merge(remotes, locals []*File) (merged []*dirList) {
 func reduceToSize(changes []*Change, isPush bool) (totalSize int64) {
 	totalSize = 0
 	for _, c := range changes {
+		if c.Op() == OpChmod {
+			// Nothing is transferred.
+			continue
+		}
 		if isPush {
 			if c.Src != nil {
 				totalSize += c.Src.Size
@@ -249,7 +321,12 @@ func reduceToSize(changes []*Change, isPush bool) (totalSize int64) {
 
 func summarizeChanges(changes []*Change, reduce bool) {
 	for _, c := range changes {
-		if c.Op() != OpNone {
+		if c.Op() == OpNone {
+			continue
+		}
+		if OutputJSON {
+			emit(newChangeRecord(c))
+		} else {
 			fmt.Println(c.Symbol(), c.Path)
 		}
 	}
@@ -273,6 +350,13 @@ func summarizeChanges(changes []*Change, reduce bool) {
 			if counter.count < 1 {
 				continue
 			}
+			if OutputJSON {
+				emit(&summaryRecord{
+					Type: "summary", Op: opNames[op],
+					Count: counter.count, SrcSize: counter.src, DestSize: counter.dest,
+				})
+				continue
+			}
 			_, name := opToString(op)
 			fmt.Printf("%s %s\n", name, counter.String())
 		}
@@ -281,14 +365,14 @@ func summarizeChanges(changes []*Change, reduce bool) {
 
 func promptForChanges() bool {
 	input := "Y"
-	fmt.Print("Proceed with the changes? [Y/n]: ")
+	logf("Proceed with the changes? [Y/n]: ")
 	fmt.Scanln(&input)
 	return strings.ToUpper(input) == "Y"
 }
 
 func printChangeList(changes []*Change, noPrompt bool, noClobber bool) bool {
 	if len(changes) == 0 {
-		fmt.Println("Everything is up-to-date.")
+		logf("Everything is up-to-date.\n")
 		return false
 	}
 
@@ -0,0 +1,205 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drive
+
+import (
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"testing"
+	"time"
+
+	drive "github.com/google/google-api-go-client/drive/v2"
+	"github.com/odeke-em/drive/config"
+)
+
+// fakeTime is the modification time of every file of the fake trees,
+// old enough for their checksums to be cached.
+var fakeTime = time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC)
+
+// fakeNode is a file of a fake tree, a folder if children is set.
+type fakeNode struct {
+	content  string
+	children map[string]*fakeNode
+}
+
+func fakeDir(children map[string]*fakeNode) *fakeNode {
+	return &fakeNode{children: children}
+}
+
+func fakeFile(content string) *fakeNode {
+	return &fakeNode{content: content}
+}
+
+// fakeDrive serves the listing of the children of a fake remote tree the
+// way the Drive API does, in a stable order, every node's id being its path.
+func fakeDrive(root *fakeNode) *httptest.Server {
+	byId := map[string]*fakeNode{"root": root}
+	var index func(id string, n *fakeNode)
+	index = func(id string, n *fakeNode) {
+		for name, child := range n.children {
+			childId := id + "/" + name
+			byId[childId] = child
+			index(childId, child)
+		}
+	}
+	index("root", root)
+
+	parentRe := regexp.MustCompile(`^"(.*)" in parents`)
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		match := parentRe.FindStringSubmatch(req.URL.Query().Get("q"))
+		if match == nil || byId[match[1]] == nil {
+			http.NotFound(w, req)
+			return
+		}
+		children := byId[match[1]].children
+		var names []string
+		for name := range children {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		list := &drive.FileList{}
+		for _, name := range names {
+			list.Items = append(list.Items, fakeRemoteFile(match[1]+"/"+name, name, children[name]))
+		}
+		json.NewEncoder(w).Encode(list)
+	}))
+}
+
+func fakeRemoteFile(id, title string, n *fakeNode) *drive.File {
+	f := &drive.File{
+		Id:           id,
+		Title:        title,
+		ModifiedDate: fakeTime.Format("2006-01-02T15:04:05.000Z"),
+	}
+	if n.children != nil {
+		f.MimeType = DriveFolderMimeType
+	} else {
+		f.MimeType = "text/plain"
+		f.FileSize = int64(len(n.content))
+		f.Md5Checksum = fmt.Sprintf("%x", md5.Sum([]byte(n.content)))
+	}
+	return f
+}
+
+func writeFakeTree(t *testing.T, absPath string, n *fakeNode) {
+	for name, child := range n.children {
+		p := filepath.Join(absPath, name)
+		if child.children != nil {
+			if err := os.Mkdir(p, 0755); err != nil {
+				t.Fatal(err)
+			}
+			writeFakeTree(t, p, child)
+		} else if err := ioutil.WriteFile(p, []byte(child.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(p, fakeTime, fakeTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestResolveChangeListConcurrently(t *testing.T) {
+	remoteTree := fakeDir(map[string]*fakeNode{
+		"a": fakeDir(map[string]*fakeNode{
+			"same.txt":    fakeFile("same"),
+			"changed.txt": fakeFile("remote"),
+		}),
+		"b": fakeDir(map[string]*fakeNode{
+			"new.txt": fakeFile("new"),
+			"deep":    fakeDir(map[string]*fakeNode{"n.txt": fakeFile("n")}),
+		}),
+		"top.txt": fakeFile("top"),
+	})
+	localTree := fakeDir(map[string]*fakeNode{
+		"a": fakeDir(map[string]*fakeNode{
+			"same.txt":    fakeFile("same"),
+			"changed.txt": fakeFile("local"),
+			"gone.txt":    fakeFile("gone"),
+		}),
+		"top.txt": fakeFile("top"),
+	})
+	// Enough siblings for the workers to be busy at every level.
+	for i := 0; i < 32; i++ {
+		name := fmt.Sprintf("f%02d.txt", i)
+		remoteTree.children["a"].children[name] = fakeFile(name)
+		localTree.children["a"].children[name] = fakeFile(name)
+	}
+
+	server := fakeDrive(remoteTree)
+	defer server.Close()
+
+	contextPath, err := ioutil.TempDir("", "drive-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(contextPath)
+	if err = os.Mkdir(filepath.Join(contextPath, ".gd"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	writeFakeTree(t, contextPath, localTree)
+
+	context := &config.Context{AbsPath: contextPath}
+	g := New(context, &Options{Recursive: true, Jobs: 8})
+	service, _ := drive.New(http.DefaultClient)
+	service.BasePath = server.URL + "/"
+	g.rem = &Remote{context: context, service: service}
+
+	want := map[string]string{
+		"/a/changed.txt": "mod",
+		"/a/gone.txt":    "delete",
+		"/b":             "add",
+		"/b/new.txt":     "add",
+		"/b/deep":        "add",
+		"/b/deep/n.txt":  "add",
+	}
+
+	var first []string
+	for run := 0; run < 10; run++ {
+		remoteRoot := NewRemoteFile(&drive.File{Id: "root", Title: "", MimeType: DriveFolderMimeType})
+		info, err := os.Stat(contextPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		localRoot := NewLocalFile(contextPath, info)
+
+		cl, err := g.resolveChangeListRecv(false, "/", "/", "", remoteRoot, localRoot)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := map[string]string{}
+		var order []string
+		for _, c := range cl {
+			got[c.Path] = opNames[c.Op()]
+			order = append(order, c.Path)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("run %d: got changes %v, want %v", run, got, want)
+		}
+		if first == nil {
+			first = order
+		} else if !reflect.DeepEqual(order, first) {
+			t.Fatalf("run %d: got order %v, want %v", run, order, first)
+		}
+	}
+}
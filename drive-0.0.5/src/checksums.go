@@ -0,0 +1,154 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drive
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/odeke-em/drive/config"
+)
+
+// RebuildChecksums rehashes every local file under the sources,
+// replacing their cached checksums. Entries of files out of the
+// sources are kept.
+func (g *Commands) RebuildChecksums() (err error) {
+	cached := checksumCache.Entries()
+	entries := map[string]string{}
+	walked := map[string]bool{}
+	err = g.walkChecksummable(func(f *File) {
+		walked[config.ChecksumIdentity(f.checksumKey)] = true
+		if checksum := computeMd5Checksum(f); checksum != "" {
+			entries[f.checksumKey] = checksum
+		}
+	})
+	if err != nil {
+		return
+	}
+	if _, err = g.mergeChecksums(cached, entries, walked); err != nil {
+		return
+	}
+	logf("Rebuilt checksums of %d files\n", len(walked))
+	return
+}
+
+// VerifyChecksums rehashes every local file under the sources that has a
+// cached checksum and reports the entries that don't match their content.
+// Stale entries and mismatches under the sources are dropped from the cache.
+func (g *Commands) VerifyChecksums() (err error) {
+	cached := checksumCache.Entries()
+	entries := map[string]string{}
+	walked := map[string]bool{}
+	verified, mismatches := 0, 0
+	err = g.walkChecksummable(func(f *File) {
+		walked[config.ChecksumIdentity(f.checksumKey)] = true
+		want, ok := cached[f.checksumKey]
+		if !ok {
+			return
+		}
+		got := computeMd5Checksum(f)
+		if got != want {
+			mismatches += 1
+			reportError(f.BlobAt, fmt.Errorf("cached checksum %s, actual %s", want, got))
+			return
+		}
+		verified += 1
+		entries[f.checksumKey] = want
+	})
+	if err != nil {
+		return
+	}
+	var dropped int
+	if dropped, err = g.mergeChecksums(cached, entries, walked); err != nil {
+		return
+	}
+	logf("Verified %d checksums, %d mismatches, %d stale entries dropped\n",
+		verified, mismatches, dropped-mismatches)
+	if mismatches >= 1 {
+		return fmt.Errorf("%d cached checksums did not match", mismatches)
+	}
+	return
+}
+
+// mergeChecksums replaces the cache with entries, plus the cached entries
+// of the files that weren't walked. Any other entry of a walked file is an
+// older version of it or a mismatch, and is dropped. Entries of files that
+// are gone can't be told apart from those out of the sources, they're only
+// dropped when the whole context was walked. It returns the number of
+// cached entries dropped.
+func (g *Commands) mergeChecksums(cached, entries map[string]string, walked map[string]bool) (dropped int, err error) {
+	whole := false
+	for _, src := range g.opts.Sources {
+		if src == "/" {
+			whole = true
+		}
+	}
+	if !whole {
+		for key, checksum := range cached {
+			if _, ok := entries[key]; ok || walked[config.ChecksumIdentity(key)] {
+				continue
+			}
+			entries[key] = checksum
+		}
+	}
+	for key := range cached {
+		if _, ok := entries[key]; !ok {
+			dropped += 1
+		}
+	}
+	err = checksumCache.Reset(entries)
+	return
+}
+
+func (g *Commands) walkChecksummable(fn func(f *File)) (err error) {
+	root := g.context.AbsPathOf("")
+	gdDir := g.context.AbsPathOf(".gd")
+
+	for _, relToRootPath := range g.opts.Sources {
+		fsPath := g.context.AbsPathOf(relToRootPath)
+		err = filepath.Walk(fsPath, func(p string, info os.FileInfo, wErr error) error {
+			if wErr != nil {
+				return wErr
+			}
+			if p == gdDir {
+				return filepath.SkipDir
+			}
+			if p != fsPath && !g.opts.Hidden && strings.HasPrefix(info.Name(), ".") {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			relPath, rErr := filepath.Rel(root, p)
+			if rErr == nil && g.context.Ignored(relPath, info.IsDir()) {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !info.Mode().IsRegular() || config.ChecksumKey(info) == "" {
+				return nil
+			}
+			fn(NewLocalFile(p, info))
+			return nil
+		})
+		if err != nil {
+			return
+		}
+	}
+	return
+}
@@ -17,6 +17,7 @@ package drive
 import (
 	"errors"
 	"path"
+	"time"
 
 	"github.com/cheggaaa/pb"
 	"github.com/odeke-em/drive/config"
@@ -26,9 +27,15 @@ var (
 	ErrNoContext = errors.New("not in a drive context")
 )
 
+// DefaultJobs is the default maximum number of concurrent tasks.
+const DefaultJobs = 8
+
 type Options struct {
 	// Depth is the number of pages/ listing recursion depth
 	Depth int
+	// Delay is how long a watched path has to stay untouched
+	// before it's pushed, if not set DefaultWatchDelay is used
+	Delay time.Duration
 	// Exports contains the formats to export your Google Docs + Sheets to
 	// e.g ["csv" "txt"]
 	Exports []string
@@ -39,53 +46,130 @@ type Options struct {
 	Force bool
 	// Hidden discovers hidden paths if set
 	Hidden bool
+	// Jobs is the maximum number of concurrent tasks,
+	// if not set DefaultJobs is used
+	Jobs int
 	// Allows listing of content in trash
 	InTrash bool
-	// Mounts is a list of all mountpoints
-	// of paths that are not in the current drive context
-	Mounts []*config.MountPoint
+	// Interval is the time between the runs of the daemon,
+	// if not set DefaultDaemonInterval is used
+	Interval time.Duration
+	// Mounts are paths outside of the current drive context to
+	// resolve besides the mounts registered in the context
+	Mounts []*config.Mount
 	// NoClobber when set prevents overwriting of stale content
 	NoClobber bool
 	// NoPrompt overwrites any prompt pauses
 	NoPrompt bool
 	Path     string
+	// PlanOut is the path to save the resolved changes to for
+	// a later `drive apply`, instead of applying them
+	PlanOut string
 	// PageSize determines the number of results returned per API call
 	PageSize  int64
 	Recursive bool
+	// Strict fails an upload whose checksum doesn't match
+	// the local content instead of re-uploading it
+	Strict bool
+	// Conflicts is the policy for paths that are a folder on one side
+	// and a file on the other, one of ConflictReport, ConflictRename
+	// or ConflictReplace
+	Conflicts string
+	// Symlinks is the policy for local symlinks, one of SymlinksFollow,
+	// SymlinksSkip or SymlinksPreserve
+	Symlinks string
 	// Sources is a of list all paths that are
 	// within the scope/path of the current gd context
 	Sources []string
 	// TypeMask contains the result of setting different type bits e.g
 	// Folder to search only for folders etc.
 	TypeMask int
+	// Wait makes commands that modify the context wait for its
+	// lock to be released instead of failing while it's held
+	Wait bool
 }
 
 type Commands struct {
 	context *config.Context
 	rem     *Remote
 	opts    *Options
+	jobs    int
+	// mounts are the registered mounts and Options.Mounts
+	mounts []*config.Mount
+	// sparse are the remote subtrees tracked, all of them if empty
+	sparse []string
+
+	// resolvers holds a token for every busy change resolution worker
+	resolvers chan struct{}
 
 	progress *pb.ProgressBar
+	// journal records the changes played, see journalPlan
+	journal *journal
+	// command is the name of the command holding the lock
+	command string
+	// syncedModes are the modes paths were last synced with, see Sync
+	syncedModes *syncedModes
 }
 
 func New(context *config.Context, opts *Options) *Commands {
 	var r *Remote
+	var mounts []*config.Mount
+	var sparse []string
 	if context != nil {
 		r = NewRemoteContext(context)
+		checksumCache = config.NewChecksumCache(context.AbsPath)
+
+		var err error
+		if mounts, err = context.Mounts(); err != nil {
+			logf("mounts: %v\n", err)
+		}
+		if sparse, err = context.SparsePaths(); err != nil {
+			logf("sparse: %v\n", err)
+		}
 	}
+	jobs := DefaultJobs
 	if opts != nil {
 		// should always start with /
 		opts.Path = path.Clean(path.Join("/", opts.Path))
+		if opts.Jobs >= 1 {
+			jobs = opts.Jobs
+		}
+		if opts.Symlinks == "" {
+			opts.Symlinks = SymlinksFollow
+		}
+		if opts.Conflicts == "" {
+			opts.Conflicts = ConflictReport
+		}
+		if opts.Delay <= 0 {
+			opts.Delay = DefaultWatchDelay
+		} else if opts.Delay < MinWatchDelay {
+			opts.Delay = MinWatchDelay
+		}
+		if opts.Interval <= 0 {
+			opts.Interval = DefaultDaemonInterval
+		}
+		mounts = append(mounts, opts.Mounts...)
 	}
-	return &Commands{
+	g := &Commands{
 		context: context,
 		rem:     r,
 		opts:    opts,
+		jobs:    jobs,
+		mounts:  mounts,
+		sparse:  sparse,
+		// The resolving goroutine itself counts as one of the jobs.
+		resolvers: make(chan struct{}, jobs-1),
+	}
+	// Every command starting from the sources honours the sparse set.
+	if opts != nil && len(sparse) >= 1 {
+		opts.Sources = g.sparseSources(opts.Sources)
 	}
+	return g
 }
 
 func (g *Commands) taskStart(numOfTasks int) {
-	if numOfTasks > 0 {
+	// The progress bar would garble the JSON records on stdout.
+	if numOfTasks > 0 && !OutputJSON {
 		g.progress = pb.StartNew(numOfTasks)
 	}
 }
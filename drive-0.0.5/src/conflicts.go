@@ -0,0 +1,109 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drive
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Policies for paths that are a folder on one side and a file on the
+// other, see Options.Conflicts.
+const (
+	// ConflictReport reports the conflict and leaves both sides alone.
+	ConflictReport = "report"
+	// ConflictRename renames the destination aside before copying the source.
+	ConflictRename = "rename"
+	// ConflictReplace deletes the destination before copying the source.
+	ConflictReplace = "replace"
+)
+
+// CheckConflictPolicy returns an error if policy isn't a known conflict policy.
+func CheckConflictPolicy(policy string) error {
+	switch policy {
+	case ConflictReport, ConflictRename, ConflictReplace:
+		return nil
+	}
+	return fmt.Errorf("unknown conflict policy %q, expecting %s, %s or %s",
+		policy, ConflictReport, ConflictRename, ConflictReplace)
+}
+
+// TypeConflict is a path that is a folder on one side and a file on the other.
+type TypeConflict struct {
+	Path        string
+	RemoteIsDir bool
+}
+
+func kindOf(isDir bool) string {
+	if isDir {
+		return "folder"
+	}
+	return "file"
+}
+
+func (c *TypeConflict) Error() string {
+	return fmt.Sprintf("remote is a %s but local is a %s, use -conflicts=%s or %s",
+		kindOf(c.RemoteIsDir), kindOf(!c.RemoteIsDir), ConflictRename, ConflictReplace)
+}
+
+type conflictRecord struct {
+	Type   string `json:"type"`
+	Path   string `json:"path"`
+	Remote string `json:"remote"`
+	Local  string `json:"local"`
+}
+
+func typesConflict(r, l *File) bool {
+	return r != nil && l != nil && r.IsDir != l.IsDir
+}
+
+// skipTypeConflict reports a conflict between r and l unless it is to be
+// resolved, in which case change is marked accordingly. It returns true if
+// the path is to be left alone.
+func (g *Commands) skipTypeConflict(change *Change, r, l *File) bool {
+	// The local directory of a mount is never replaced or renamed aside.
+	if g.opts.Conflicts == ConflictReport || g.opts.NoClobber || g.isMountRoot(change.Path) {
+		conflict := &TypeConflict{Path: change.Path, RemoteIsDir: r.IsDir}
+		if OutputJSON {
+			emit(&conflictRecord{
+				Type: "conflict", Path: conflict.Path,
+				Remote: kindOf(r.IsDir), Local: kindOf(l.IsDir),
+			})
+		} else {
+			reportError(conflict.Path, conflict)
+		}
+		return true
+	}
+	change.RenameAside = g.opts.Conflicts == ConflictRename
+	return false
+}
+
+// asideName returns the name a conflicting file named name is renamed to.
+func asideName(name string) string {
+	return fmt.Sprintf("%s.conflict-%s", name, time.Now().Format("20060102-150405"))
+}
+
+func (g *Commands) localRenameAside(change *Change) (err error) {
+	defer g.taskDone()
+	p := change.Dest.BlobAt
+	return os.Rename(p, filepath.Join(filepath.Dir(p), asideName(filepath.Base(p))))
+}
+
+func (g *Commands) remoteRenameAside(change *Change) (err error) {
+	defer g.taskDone()
+	return g.rem.Rename(change.Dest.Id, asideName(titleOf(change.Dest)))
+}
@@ -0,0 +1,78 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drive
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// DefaultDaemonInterval is the default time between the runs of the daemon.
+const DefaultDaemonInterval = 5 * time.Minute
+
+// Daemon syncs the sources every Options.Interval until it receives SIGTERM
+// or SIGINT. Runs never overlap: a run still going when the next one is due
+// delays it to the following tick. On shutdown the current run, if any, is
+// finished first so that no transfer is left halfway. Like Sync it never
+// deletes, content deleted on one side is restored from the other.
+func (g *Commands) Daemon() error {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGTERM, os.Interrupt)
+	defer signal.Stop(sigs)
+
+	ticker := time.NewTicker(g.opts.Interval)
+	defer ticker.Stop()
+
+	done := make(chan error, 1)
+	running := false
+	run := func() {
+		running = true
+		// Ignore rules changed between runs apply to the next one.
+		g.context.RefreshIgnored()
+		logf("Syncing at %s\n", time.Now().Format(time.RFC3339))
+		go func() {
+			done <- g.Sync()
+		}()
+	}
+
+	run()
+	for {
+		select {
+		case <-ticker.C:
+			if running {
+				logf("The previous run is still going, skipping this one\n")
+				continue
+			}
+			run()
+		case err := <-done:
+			running = false
+			if err != nil {
+				logf("daemon: %v\n", err)
+			}
+			logf("Run finished at %s\n", time.Now().Format(time.RFC3339))
+		case sig := <-sigs:
+			logf("%v: shutting down\n", sig)
+			if running {
+				logf("Waiting for the current run to finish\n")
+				if err := <-done; err != nil {
+					logf("daemon: %v\n", err)
+				}
+			}
+			return nil
+		}
+	}
+}
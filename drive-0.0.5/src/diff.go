@@ -15,6 +15,7 @@
 package drive
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -32,13 +33,8 @@ var Ruler = strings.Repeat("*", 80)
 
 func (g *Commands) Diff() (err error) {
 	var cl []*Change
-
-	for _, relToRootPath := range g.opts.Sources {
-		fsPath := g.context.AbsPathOf(relToRootPath)
-		ccl, cErr := g.changeListResolve(relToRootPath, fsPath, true)
-		if cErr == nil && len(ccl) > 0 {
-			cl = append(cl, ccl...)
-		}
+	if cl, err = g.resolveSources(true); err != nil {
+		return
 	}
 
 	var diffUtilPath string
@@ -50,7 +46,7 @@ func (g *Commands) Diff() (err error) {
 	for _, c := range cl {
 		dErr := g.perDiff(c, diffUtilPath, ".")
 		if dErr != nil {
-			fmt.Println(dErr)
+			reportError(c.Path, dErr)
 		}
 	}
 	return
@@ -58,7 +54,9 @@ func (g *Commands) Diff() (err error) {
 
 func (g *Commands) perDiff(change *Change, diffProgPath, cwd string) (err error) {
 	defer func() {
-		fmt.Println(Ruler)
+		if !OutputJSON {
+			fmt.Println(Ruler)
+		}
 	}()
 
 	l, r := change.Src, change.Dest
@@ -137,18 +135,28 @@ func (g *Commands) perDiff(change *Change, diffProgPath, cwd string) (err error)
 		return
 	}
 
-	fmt.Printf("%s\n%s %s\n", Ruler, l.Name, r.Name)
+	var stdout io.Writer = os.Stdout
+	var diffOutput bytes.Buffer
+	if OutputJSON {
+		stdout = &diffOutput
+	} else {
+		fmt.Printf("%s\n%s %s\n", Ruler, l.Name, r.Name)
+	}
 
 	diffCmd := exec.Cmd{
 		Args:   []string{diffProgPath, l.BlobAt, frTmp.Name()},
 		Dir:    cwd,
 		Path:   diffProgPath,
 		Stdin:  nil,
-		Stdout: os.Stdout,
+		Stdout: stdout,
 		Stderr: os.Stderr,
 	}
 
 	// Normally when elements differ diff returns a non-zero code
 	_ = diffCmd.Run()
+
+	if OutputJSON {
+		emit(&diffRecord{Type: "diff", Path: change.Path, Diff: diffOutput.String()})
+	}
 	return
 }
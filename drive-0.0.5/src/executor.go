@@ -0,0 +1,254 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drive
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	gopath "path"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// errInterrupted is the error of the tasks that weren't
+// started because the command was interrupted.
+var errInterrupted = errors.New("interrupted")
+
+type changeTask struct {
+	change *Change
+	// deps are the tasks that have to complete before this task starts.
+	deps []*changeTask
+	done chan struct{}
+	err  error
+}
+
+type byDepth []*changeTask
+
+func (tl byDepth) Len() int {
+	return len(tl)
+}
+
+func (tl byDepth) Less(i, j int) bool {
+	return pathDepth(tl[i].change.Path) < pathDepth(tl[j].change.Path)
+}
+
+func (tl byDepth) Swap(i, j int) {
+	tl[i], tl[j] = tl[j], tl[i]
+}
+
+func pathDepth(p string) int {
+	return strings.Count(strings.Trim(p, "/"), "/")
+}
+
+func newChangeTask(c *Change, deps ...*changeTask) *changeTask {
+	return &changeTask{change: c, deps: deps, done: make(chan struct{})}
+}
+
+// closestAncestor returns the task of the closest ancestor of p in byPath.
+func closestAncestor(byPath map[string]*changeTask, p string) *changeTask {
+	for p != "/" && p != "." && p != "" {
+		p = gopath.Dir(p)
+		if t, ok := byPath[p]; ok {
+			return t
+		}
+	}
+	return nil
+}
+
+// splitTypeChange splits a change between a directory and an ordinary
+// file into the deletion, or renaming aside, of the destination followed
+// by the addition of the source. The addition is c itself, so that changes linked to it
+// through ParentChange see its RemoteId. It returns nil for any other change.
+func splitTypeChange(c *Change) (del, add *Change) {
+	if c.Src == nil || c.Dest == nil || c.Src.sameDirType(c.Dest) {
+		return nil, nil
+	}
+	del = &Change{Path: c.Path, Parent: c.Parent, ParentId: c.ParentId, Dest: c.Dest, RenameAside: c.RenameAside}
+	c.Dest = nil
+	return del, c
+}
+
+// scheduleChanges orders cl into two phases. In the first, additions and
+// modifications run top-down: a change waits for the change to its closest
+// ancestor path. In the second, deletions run bottom-up: a deletion waits
+// for the deletions of its descendants. A change between a directory and
+// an ordinary file is played as a deletion followed by an addition in the
+// first phase. The tasks of each phase are returned in dispatch order.
+func scheduleChanges(cl []*Change) (adds, deletes []*changeTask) {
+	addsByPath := map[string]*changeTask{}
+	deletesByPath := map[string]*changeTask{}
+
+	for _, c := range cl {
+		if c.Op() == OpDelete {
+			t := newChangeTask(c)
+			deletes = append(deletes, t)
+			deletesByPath[c.Path] = t
+			continue
+		}
+
+		var t *changeTask
+		if del, add := splitTypeChange(c); del != nil {
+			delTask := newChangeTask(del)
+			adds = append(adds, delTask)
+			t = newChangeTask(add, delTask)
+		} else {
+			t = newChangeTask(c)
+		}
+		adds = append(adds, t)
+		addsByPath[c.Path] = t
+	}
+
+	for path, t := range addsByPath {
+		if parent := closestAncestor(addsByPath, path); parent != nil {
+			t.deps = append(t.deps, parent)
+		}
+	}
+	for path, t := range deletesByPath {
+		if parent := closestAncestor(deletesByPath, path); parent != nil {
+			parent.deps = append(parent.deps, t)
+		}
+	}
+
+	// Dependencies are dispatched before their dependents, so a worker
+	// waiting on a dependency can't starve that dependency of a worker.
+	sort.Stable(byDepth(adds))
+	sort.Stable(sort.Reverse(byDepth(deletes)))
+	return
+}
+
+// playConcurrently plays every change in cl with up to Options.Jobs changes
+// in flight, in the order set by scheduleChanges. A change whose dependencies
+// failed is failed without being played. Failures are reported per change
+// and summarized in the returned error.
+func (g *Commands) playConcurrently(cl []*Change, play func(c *Change) error) error {
+	adds, deletes := scheduleChanges(cl)
+	g.taskStart(len(adds) + len(deletes))
+	defer g.taskFinish()
+
+	interrupted, stop := interruptible()
+	defer stop()
+
+	g.playTasks(adds, play, interrupted)
+	g.playTasks(deletes, play, interrupted)
+
+	failed, left := 0, 0
+	for _, t := range append(adds, deletes...) {
+		if t.err == nil {
+			continue
+		}
+		if t.err == errInterrupted {
+			left += 1
+			continue
+		}
+		failed += 1
+		if OutputJSON {
+			emit(&errorRecord{Type: "error", Path: t.change.Path, Op: opNames[t.change.Op()], Error: t.err.Error()})
+		} else {
+			fmt.Printf("\033[91m%s\033[00m %s: %v\n", t.change.Symbol(), t.change.Path, t.err)
+		}
+	}
+	if left >= 1 {
+		return fmt.Errorf("interrupted, %d changes left for `drive resume`", left+failed)
+	}
+	if failed >= 1 {
+		return fmt.Errorf("%d of %d changes failed", failed, len(adds)+len(deletes))
+	}
+	return nil
+}
+
+// dispatch hands t to a worker, unless the command is interrupted first.
+func dispatch(taskChan chan *changeTask, t *changeTask, interrupted chan struct{}) bool {
+	select {
+	case <-interrupted:
+		return false
+	default:
+	}
+	select {
+	case taskChan <- t:
+		return true
+	case <-interrupted:
+		return false
+	}
+}
+
+// interruptible returns a channel closed on the first interrupt or terminate
+// signal, for the command to stop starting changes and let those in flight
+// finish. A second signal exits right away. stop restores the default
+// handling of the signals.
+func interruptible() (interrupted chan struct{}, stop func()) {
+	interrupted = make(chan struct{})
+	sigChan := make(chan os.Signal, 1)
+	quit := make(chan struct{})
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-sigChan:
+		case <-quit:
+			return
+		}
+		logf("\nInterrupted, waiting for the changes in flight, interrupt again to exit now\n")
+		close(interrupted)
+		select {
+		case <-sigChan:
+			os.Exit(1)
+		case <-quit:
+		}
+	}()
+	stop = func() {
+		signal.Stop(sigChan)
+		close(quit)
+	}
+	return
+}
+
+func (g *Commands) playTasks(queue []*changeTask, play func(c *Change) error, interrupted chan struct{}) {
+	taskChan := make(chan *changeTask)
+	var wg sync.WaitGroup
+	wg.Add(g.jobs)
+	for i := 0; i < g.jobs; i++ {
+		go func() {
+			defer wg.Done()
+			for t := range taskChan {
+				for _, dep := range t.deps {
+					<-dep.done
+					if dep.err == errInterrupted && t.err == nil {
+						t.err = errInterrupted
+					} else if dep.err != nil && t.err == nil {
+						t.err = fmt.Errorf("depends on %s which failed", dep.change.Path)
+					}
+				}
+				if t.err != nil {
+					g.taskDone()
+				} else if t.err = play(t.change); t.err == nil {
+					g.journalDone(t.change)
+				}
+				close(t.done)
+			}
+		}()
+	}
+	for _, t := range queue {
+		if !dispatch(taskChan, t, interrupted) {
+			t.err = errInterrupted
+			g.taskDone()
+			close(t.done)
+		}
+	}
+	close(taskChan)
+	wg.Wait()
+}
@@ -21,47 +21,76 @@ import (
 const (
 	AboutKey      = "about"
 	AllKey        = "all"
+	ApplyKey      = "apply"
+	ChecksumsKey  = "checksums"
+	DaemonKey     = "daemon"
 	DiffKey       = "diff"
 	EmptyTrashKey = "emptytrash"
 	FeaturesKey   = "features"
 	InitKey       = "init"
 	ListKey       = "list"
+	LogKey        = "log"
+	MountKey      = "mount"
 	PullKey       = "pull"
 	PushKey       = "push"
 	PubKey        = "pub"
 	HelpKey       = "help"
 	QuotaKey      = "quota"
+	ResumeKey     = "resume"
+	SparseKey     = "sparse"
+	SyncKey       = "sync"
 	TouchKey      = "touch"
 	TrashKey      = "trash"
 	UntrashKey    = "untrash"
 	UnpubKey      = "unpub"
 	VersionKey    = "version"
+	WatchKey      = "watch"
 )
 
 const (
 	DescAbout      = "print out information about your Google drive"
 	DescAll        = "print out the entire help section"
+	DescApply      = "executes a plan saved by push or pull -plan-out"
+	DescChecksums  = "verifies or rebuilds the cache of local file checksums"
+	DescDaemon     = "keeps the context in sync at a regular interval"
 	DescDiff       = "compares local files with their remote equivalent"
 	DescEmptyTrash = "permanently cleans out your trash"
 	DescFeatures   = "returns information about the features of your drive"
 	DescHelp       = "Get help for a topic"
 	DescInit       = "initializes a directory and authenticates user"
 	DescList       = "lists the contents of remote path"
+	DescLog        = "lists the changes made by past runs"
+	DescMount      = "maps remote paths to local directories outside the context"
 	DescQuota      = "prints out information related to your quota space"
 	DescPublish    = "publishes a file and prints its publicly available url"
 	DescPull       = "pulls remote changes from Google Drive"
 	DescPush       = "push local changes to Google Drive"
+	DescResume     = "finishes a push or pull that was interrupted or failed"
+	DescSparse     = "tracks only chosen remote subtrees"
+	DescSync       = "pulls remote changes and pushes local changes in one pass"
 	DescTouch      = "updates a remote file's modification time to that currently on the server"
 	DescTrash      = "moves files to trash"
 	DescUntrash    = "restores files from trash to their original locations"
 	DescUnpublish  = "revokes public access to a file"
 	DescVersion    = "prints the version"
+	DescWatch      = "pushes local changes as they happen"
 )
 
 var docMap = map[string][]string{
 	AboutKey: []string{
 		DescAbout,
 	},
+	ApplyKey: []string{
+		DescApply, "Executes exactly the changes saved in the plan e.g",
+		"\t* `drive push -plan-out plan.json` then `drive apply plan.json`",
+		"Changes whose remote etag or local content changed since planning are refused",
+	},
+	ChecksumsKey: []string{
+		DescChecksums, "Checksums of local files are cached in the .gd directory",
+		"keyed by device, inode, size and modification time",
+		"\t* Verify the cached checksums: `drive checksums`",
+		"\t* Rehash every file: `drive checksums -rebuild`",
+	},
 	DiffKey: []string{
 		DescDiff, "Accepts multiple remote paths for line by line comparison",
 	},
@@ -79,24 +108,70 @@ var docMap = map[string][]string{
 	PullKey: []string{
 		DescPull, "Downloads content from the remote drive or modifies",
 		" local content to match that on your Google Drive",
+		"\t* Mounted pull: `drive pull -mount /remote/path=/local/dir`",
 	},
 	PushKey: []string{
 		DescPush, "Uploads content to your Google Drive from your local path",
 		"Push comes in a couple of flavors",
 		"\t* Ordinary push: `drive push path1 path2 path3`",
 		"\t* Mounted push: `drive push -m path1 [path2 path3] drive_context_path`",
+		"\t* Planned push: `drive push -plan-out plan.json path1` to review before `drive apply`",
+	},
+	DaemonKey: []string{
+		DescDaemon, "Runs a sync of the given paths, or the current directory, every -interval",
+		"Runs never overlap, one still going when the next is due delays it",
+		"SIGTERM or SIGINT stops the daemon once the current run is finished",
+		"Like sync, the daemon never deletes content from either side: a file trashed",
+		"remotely is pulled back and a file deleted locally is pushed back by the next run",
+		"To delete content, stop the daemons, push the deletion and pull it elsewhere",
+	},
+	ResumeKey: []string{
+		DescResume, "Changes are journaled in .gd/journal as push, pull, sync and apply play them",
+		"Only the paths of the changes left undone are resolved again",
+		"\t* Resume after an interruption: `drive resume`",
+	},
+	SparseKey: []string{
+		DescSparse, "The subtrees are kept in .gd/sparse and honoured by every command taking paths",
+		"Paths out of the sparse set are neither pulled, pushed nor deleted on either side",
+		"\t* Track and pull a subtree: `drive sparse add /Projects/drive`",
+		"\t* List the subtrees: `drive sparse list`",
+		"\t* Stop tracking a subtree and delete its local copy: `drive sparse remove /Projects/drive`",
+		"Removing refuses a subtree with local changes that weren't pushed, unless -force is set",
+	},
+	SyncKey: []string{
+		DescSync, "Content only present on one side is copied to the other side",
+		"Content modified on both sides is settled in favor of the most recent copy",
+		"Sync never deletes content from either side",
 	},
 	ListKey: []string{
 		DescList,
 		"List the information related a remote path not necessarily present locally",
 		"Allows printing of long options and by default does minimal printing",
 	},
+	LogKey: []string{
+		DescLog, "Every change executed is appended to .gd/history",
+		"Lists the changes made under the given paths, or the current directory",
+		"\t* Changes of a file: `drive log notes.txt`",
+		"\t* Overwrites in June: `drive log -op mod -since 2015-06-01 -until 2015-07-01`",
+	},
+	MountKey: []string{
+		DescMount, "Mounts are kept in the .gd directory and included by push, pull, sync and diff",
+		"\t* Mount: `drive mount add /mnt/photos /Backups/photos`",
+		"\t* List the mounts: `drive mount list`",
+		"\t* Unmount, leaving the local files alone: `drive mount remove /Backups/photos`",
+	},
 	PubKey:     []string{DescPublish, "Accepts multiple paths"},
 	QuotaKey:   []string{DescQuota},
 	TouchKey:   []string{DescTouch},
 	TrashKey:   []string{DescTrash, "Accepts multiple paths"},
 	UntrashKey: []string{DescUntrash, "Accepts multiple paths"},
 	UnpubKey:   []string{DescUnpublish, "Accepts multiple paths"},
+	WatchKey: []string{
+		DescWatch, "Watches the given paths, or the current directory, until interrupted",
+		"Bursts of changes are pushed together once untouched for -delay, 2s by default",
+		"Files still growing or being rewritten are pushed once they settle",
+		"Hidden and ignored paths are left out like they are by push",
+	},
 	VersionKey: []string{
 		DescVersion, fmt.Sprintf("current version is: %s", Version),
 	},
@@ -110,6 +185,10 @@ func ShowAllDescriptions() {
 }
 
 func PrintVersion() {
+	if OutputJSON {
+		emit(&versionRecord{Type: "version", Version: Version})
+		return
+	}
 	fmt.Printf("drive version %s\n", Version)
 }
 
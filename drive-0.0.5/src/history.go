@@ -0,0 +1,255 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drive
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	gopath "path"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/odeke-em/drive/config"
+)
+
+var historyMu sync.Mutex
+
+// historyRecord is an executed change, as kept in .gd/history.
+type historyRecord struct {
+	Type    string    `json:"type"`
+	Time    time.Time `json:"time"`
+	Command string    `json:"command"`
+	Op      string    `json:"op"`
+	Path    string    `json:"path"`
+	Id      string    `json:"id,omitempty"`
+	Size    int64     `json:"size"`
+	// From is the side the change was copied from, local or remote
+	From      string `json:"from"`
+	LocalPath string `json:"local_path"`
+	Before    string `json:"checksum_before,omitempty"`
+	After     string `json:"checksum_after,omitempty"`
+	// Mode is the permission bits both sides have after
+	// the change, as stored in the ModeProperty
+	Mode string `json:"mode,omitempty"`
+}
+
+// CheckOpName returns an error if name isn't the name of an op.
+func CheckOpName(name string) error {
+	for op, opName := range opNames {
+		if op != OpNone && opName == name {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown op %q, expecting one of add, delete, mod or chmod", name)
+}
+
+func (g *Commands) historyPath() string {
+	return g.context.AbsPathOf(gopath.Join(".gd", "history"))
+}
+
+// recorded wraps play to append every change it executes to the history.
+// The checksum of the destination is taken before it's overwritten.
+func (g *Commands) recorded(isPush bool, play func(c *Change) error) func(c *Change) error {
+	return func(c *Change) (err error) {
+		op := c.Op()
+		before := md5Checksum(c.Dest)
+		if err = play(c); err != nil {
+			return
+		}
+
+		rec := &historyRecord{
+			Type:      "history",
+			Time:      time.Now().UTC(),
+			Command:   g.command,
+			Op:        opNames[op],
+			Path:      c.Path,
+			From:      "remote",
+			LocalPath: g.localPathOf(c.Path),
+			Before:    before,
+		}
+		if isPush {
+			rec.From = "local"
+		}
+		if c.Src != nil {
+			rec.Size = c.Src.Size
+			rec.After = md5Checksum(c.Src)
+		} else if c.Dest != nil {
+			rec.Size = c.Dest.Size
+		}
+		if c.Src != nil && c.Src.Mode != 0 && op != OpDelete {
+			rec.Mode = fmt.Sprintf("%04o", c.Src.Mode)
+		}
+		if c.UploadedChecksum != "" {
+			rec.After = c.UploadedChecksum
+		}
+		switch {
+		case c.RemoteId != "":
+			rec.Id = c.RemoteId
+		case isPush && c.Dest != nil:
+			rec.Id = c.Dest.Id
+		case !isPush && c.Src != nil:
+			rec.Id = c.Src.Id
+		}
+		if hErr := g.appendHistory(rec); hErr != nil {
+			logf("history: %v\n", hErr)
+		}
+		return
+	}
+}
+
+func (g *Commands) appendHistory(rec *historyRecord) (err error) {
+	var data []byte
+	if data, err = json.Marshal(rec); err != nil {
+		return
+	}
+	historyMu.Lock()
+	defer historyMu.Unlock()
+
+	var f *os.File
+	if f, err = os.OpenFile(g.historyPath(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600); err != nil {
+		return
+	}
+	if _, err = f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return
+	}
+	return f.Close()
+}
+
+// Log prints the history of the changes executed under the sources, between
+// since and until if they're set. If ops is set, only changes of those ops
+// are printed.
+func (g *Commands) Log(since, until time.Time, ops []string) (err error) {
+	var f *os.File
+	if f, err = os.Open(g.historyPath()); err != nil {
+		if os.IsNotExist(err) {
+			logf("No history yet\n")
+			return nil
+		}
+		return
+	}
+	defer f.Close()
+
+	wantOp := map[string]bool{}
+	for _, op := range ops {
+		wantOp[op] = true
+	}
+
+	rd := bufio.NewReader(f)
+	for {
+		line, rErr := rd.ReadBytes('\n')
+		if rErr == io.EOF {
+			break
+		}
+		if rErr != nil {
+			return rErr
+		}
+		rec := &historyRecord{}
+		if jErr := json.Unmarshal(line, rec); jErr != nil {
+			continue
+		}
+		if !since.IsZero() && rec.Time.Before(since) {
+			continue
+		}
+		if !until.IsZero() && !rec.Time.Before(until) {
+			continue
+		}
+		if len(wantOp) >= 1 && !wantOp[rec.Op] {
+			continue
+		}
+		if !g.underSources(rec.Path) {
+			continue
+		}
+		printHistoryRecord(rec)
+	}
+	return
+}
+
+func (g *Commands) underSources(p string) bool {
+	for _, src := range g.opts.Sources {
+		if config.IsUnder(p, src) {
+			return true
+		}
+	}
+	return false
+}
+
+func printHistoryRecord(rec *historyRecord) {
+	if OutputJSON {
+		emit(rec)
+		return
+	}
+	fmt.Printf("%s %-7s %-6s %s\n", rec.Time.Local().Format("2006-01-02 15:04:05"), rec.Command, rec.Op, rec.Path)
+	fmt.Printf("    from %s, %s", rec.From, prettyBytes(rec.Size))
+	if rec.Id != "" {
+		fmt.Printf(", id %s", rec.Id)
+	}
+	if rec.Before != "" || rec.After != "" {
+		fmt.Printf(", md5 %s -> %s", orNone(rec.Before), orNone(rec.After))
+	}
+	fmt.Println()
+}
+
+func orNone(checksum string) string {
+	if checksum == "" {
+		return "none"
+	}
+	return checksum
+}
+
+// syncedModes holds the permission bits every path last had on both sides,
+// as recorded in the history. It's only read the first time it's needed.
+type syncedModes struct {
+	once  sync.Once
+	path  string
+	modes map[string]os.FileMode
+}
+
+// last returns the mode p was last synced with, if it's known.
+func (s *syncedModes) last(p string) (mode os.FileMode, ok bool) {
+	s.once.Do(func() {
+		s.modes = map[string]os.FileMode{}
+		f, err := os.Open(s.path)
+		if err != nil {
+			return
+		}
+		defer f.Close()
+
+		rd := bufio.NewReader(f)
+		for {
+			line, rErr := rd.ReadBytes('\n')
+			if rErr != nil {
+				return
+			}
+			rec := &historyRecord{}
+			if jErr := json.Unmarshal(line, rec); jErr != nil {
+				continue
+			}
+			if rec.Op == opNames[OpDelete] {
+				delete(s.modes, rec.Path)
+				continue
+			}
+			if m, pErr := strconv.ParseUint(rec.Mode, 8, 32); pErr == nil {
+				s.modes[rec.Path] = os.FileMode(m).Perm()
+			}
+		}
+	})
+	mode, ok = s.modes[p]
+	return
+}
@@ -0,0 +1,340 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drive
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	gopath "path"
+	"sync"
+)
+
+// journalRecord is a line of the journal, either the plan of changes about
+// to be played or the completion of one of the changes journaled so far.
+type journalRecord struct {
+	Plan *Plan `json:"plan,omitempty"`
+	// Done is the position of the completed change among
+	// the changes of all the plans of the journal
+	Done *int `json:"done,omitempty"`
+}
+
+// journal records the changes played by a command in .gd/journal, every
+// record is synced to disk before the command goes on. The journal is
+// removed once all its changes are done, what's left of an interrupted
+// or failed run is finished by `drive resume`.
+type journal struct {
+	sync.Mutex
+	f *os.File
+	// tmpPath is where the journal is written until its first
+	// plan moves it in place of the journal it carries over
+	tmpPath string
+	// index is the position of every journaled change
+	index map[*Change]int
+	total int
+	done  int
+}
+
+func (g *Commands) journalPath() string {
+	return g.context.AbsPathOf(gopath.Join(".gd", "journal"))
+}
+
+func (j *journal) write(rec *journalRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if _, err = j.f.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	return j.f.Sync()
+}
+
+// openJournal starts the journal of the command, carrying over the changes
+// left undone by a previous run, which are only done by `drive resume`.
+// The journal replaces the previous one once its first plan is written.
+func (g *Commands) openJournal(carried []*Plan) (err error) {
+	tmpPath := g.journalPath() + ".tmp"
+	var f *os.File
+	if f, err = os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY|os.O_APPEND, 0600); err != nil {
+		return
+	}
+	j := &journal{f: f, tmpPath: tmpPath, index: map[*Change]int{}}
+	for _, plan := range carried {
+		if len(plan.Changes) < 1 {
+			continue
+		}
+		if err = j.write(&journalRecord{Plan: plan}); err != nil {
+			f.Close()
+			return
+		}
+		j.total += len(plan.Changes)
+	}
+	g.journal = j
+	return
+}
+
+// journalPlan records the changes of cl that aren't journaled yet. The
+// changes left undone by an interrupted run are carried over to the
+// journal of the command, for `drive resume` to still finish them.
+func (g *Commands) journalPlan(cl []*Change, isPush bool, exports []string) (err error) {
+	var journaled []*Change
+	for _, c := range cl {
+		if g.journal != nil {
+			if _, ok := g.journal.index[c]; ok {
+				continue
+			}
+		}
+		if c.Op() != OpNone {
+			journaled = append(journaled, c)
+		}
+	}
+	if len(journaled) < 1 {
+		return
+	}
+
+	if g.journal == nil {
+		carried, rErr := readJournal(g.journalPath())
+		if rErr != nil && !os.IsNotExist(rErr) {
+			return rErr
+		}
+		if len(carried) >= 1 {
+			logf("Keeping the changes left undone by an interrupted run for `drive resume`\n")
+		}
+		if err = g.openJournal(carried); err != nil {
+			return
+		}
+	}
+	j := g.journal
+	j.Lock()
+	defer j.Unlock()
+
+	plan := g.newPlan(isPush, exports)
+	for _, c := range journaled {
+		plan.Changes = append(plan.Changes, toPlanChange(c))
+	}
+	if err = j.write(&journalRecord{Plan: plan}); err != nil {
+		return
+	}
+	if j.tmpPath != "" {
+		if err = os.Rename(j.tmpPath, g.journalPath()); err != nil {
+			return
+		}
+		j.tmpPath = ""
+	}
+	for _, c := range journaled {
+		j.index[c] = j.total
+		j.total += 1
+	}
+	return
+}
+
+// journalDone records the completion of c.
+func (g *Commands) journalDone(c *Change) {
+	j := g.journal
+	if j == nil {
+		return
+	}
+	j.Lock()
+	defer j.Unlock()
+	i, ok := j.index[c]
+	if !ok {
+		return
+	}
+	if err := j.write(&journalRecord{Done: &i}); err != nil {
+		logf("journal: %v\n", err)
+		return
+	}
+	j.done += 1
+}
+
+// journalFinish removes the journal if all its changes are done,
+// otherwise it's left for `drive resume`.
+func (g *Commands) journalFinish() {
+	j := g.journal
+	if j == nil {
+		return
+	}
+	j.Lock()
+	defer j.Unlock()
+	if j.done < j.total {
+		return
+	}
+	j.f.Close()
+	if err := os.Remove(g.journalPath()); err != nil {
+		logf("journal: %v\n", err)
+	}
+	g.journal = nil
+}
+
+// readJournal returns the plans of the journal at p with only the changes
+// that weren't done. A last record cut short by a crash is ignored.
+func readJournal(p string) (plans []*Plan, err error) {
+	var f *os.File
+	if f, err = os.Open(p); err != nil {
+		return
+	}
+	defer f.Close()
+
+	var changes []*planChange
+	var planOf []*Plan
+	done := map[int]bool{}
+	rd := bufio.NewReader(f)
+	for {
+		line, rErr := rd.ReadBytes('\n')
+		if rErr == io.EOF {
+			break
+		}
+		if rErr != nil {
+			return nil, rErr
+		}
+		rec := &journalRecord{}
+		if err = json.Unmarshal(line, rec); err != nil {
+			return nil, fmt.Errorf("%s: corrupted journal: %v", p, err)
+		}
+		if rec.Plan != nil {
+			plans = append(plans, rec.Plan)
+			for _, pc := range rec.Plan.Changes {
+				changes = append(changes, pc)
+				planOf = append(planOf, rec.Plan)
+			}
+		}
+		if rec.Done != nil {
+			done[*rec.Done] = true
+		}
+	}
+
+	for _, plan := range plans {
+		plan.Changes = nil
+	}
+	for i, pc := range changes {
+		if !done[i] {
+			planOf[i].Changes = append(planOf[i].Changes, pc)
+		}
+	}
+	return
+}
+
+// Resume finishes the run interrupted or failed that left a journal. Only the
+// paths of the changes that weren't done are resolved again, with the options
+// of their run, the changes already done and the paths the run didn't touch
+// are left alone.
+func (g *Commands) Resume() (err error) {
+	var unlock func()
+	if unlock, err = g.lock(ResumeKey); err != nil {
+		return
+	}
+	defer unlock()
+
+	var plans []*Plan
+	if plans, err = readJournal(g.journalPath()); err != nil {
+		if os.IsNotExist(err) {
+			logf("Nothing to resume\n")
+			return nil
+		}
+		return
+	}
+
+	var resumed []*resumedPlan
+	var cl []*Change
+	g.opts.Recursive = false
+	for _, plan := range plans {
+		if plan.Context != g.context.AbsPath {
+			return fmt.Errorf("journal was made for context %s, not %s", plan.Context, g.context.AbsPath)
+		}
+		rp := &resumedPlan{plan: plan}
+		if err = g.restorePlanOptions(plan); err != nil {
+			return
+		}
+		for _, pc := range plan.Changes {
+			ccl, rErr := g.resumeChange(pc, plan.Push)
+			if rErr != nil {
+				return fmt.Errorf("%s: %v", pc.Path, rErr)
+			}
+			rp.cl = append(rp.cl, ccl...)
+		}
+		resumed = append(resumed, rp)
+		cl = append(cl, rp.cl...)
+	}
+
+	if len(cl) < 1 {
+		logf("Everything left was done already\n")
+		return os.Remove(g.journalPath())
+	}
+	if !printChangeList(cl, g.opts.NoPrompt, false) {
+		return
+	}
+	// Every plan is journaled before any is played, for an
+	// interruption of the first not to lose the others.
+	if err = g.openJournal(nil); err != nil {
+		return
+	}
+	for _, rp := range resumed {
+		if err = g.restorePlanOptions(rp.plan); err != nil {
+			return
+		}
+		if err = g.journalPlan(rp.cl, rp.plan.Push, rp.plan.Exports); err != nil {
+			return
+		}
+	}
+	for _, rp := range resumed {
+		if err = g.restorePlanOptions(rp.plan); err != nil {
+			return
+		}
+		if rp.plan.Push {
+			err = g.playPushChangeList(rp.cl)
+		} else {
+			err = g.playPullChangeList(rp.cl, rp.plan.Exports)
+		}
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// resumedPlan is a journaled plan along with the changes
+// its undone changes resolve to now.
+type resumedPlan struct {
+	plan *Plan
+	cl   []*Change
+}
+
+// resumeChange resolves again the single path of a change that wasn't done,
+// the change could have been partly applied before the interruption.
+func (g *Commands) resumeChange(pc *planChange, isPush bool) (cl []*Change, err error) {
+	var r, l *File
+	if r, err = g.rem.FindByPath(pc.Path); err != nil && err != ErrPathNotExists {
+		return
+	}
+	if l, err = g.statLocal(pc.Path); err != nil {
+		return
+	}
+	if l != nil {
+		l.Title = remoteTitle(g.context, pc.Path, l.Name)
+	} else if _, sErr := os.Lstat(g.localPathOf(pc.Path)); sErr == nil {
+		// A symlink left out isn't taken as deleted.
+		return
+	}
+
+	var parentId string
+	if isPush {
+		parentId = g.remoteParentId(pc.Path)
+	}
+	g.opts.Force, g.opts.NoClobber = pc.Force, pc.NoClobber
+	return g.resolveChangeListRecv(isPush, pc.Parent, pc.Path, parentId, r, l)
+}
@@ -93,7 +93,7 @@ func (g *Commands) List() (err error) {
 		relPaths = append(relPaths, relPath)
 		r, rErr := resolver(relPath)
 		if rErr != nil {
-			fmt.Printf("%v: '%s'\n", rErr, relPath)
+			reportError(relPath, rErr)
 			return
 		}
 		remotes = append(remotes, r)
@@ -125,6 +125,10 @@ func (g *Commands) List() (err error) {
 }
 
 func (f *File) pretty(opt attribute) {
+	if OutputJSON {
+		emit(newFileRecord(fmt.Sprintf("%s/%s", opt.parent, f.Name), f))
+		return
+	}
 	if opt.minimal {
 		fmt.Printf("%s/%s\n", opt.parent, f.Name)
 		return
@@ -211,7 +215,7 @@ func (g *Commands) breadthFirst(parentId, parent,
 		}
 		res, err := req.Do()
 		if err != nil {
-			fmt.Println(err)
+			reportError(headPath, err)
 			return false
 		}
 
@@ -265,7 +269,7 @@ func isMinimal(mask int) bool {
 
 func nextPage() bool {
 	var input string
-	fmt.Printf("---More---")
+	logf("---More---")
 	fmt.Scanln(&input)
 	if len(input) >= 1 && strings.ToLower(input[:1]) == "q" {
 		return false
@@ -0,0 +1,35 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drive
+
+import "github.com/odeke-em/drive/config"
+
+// lock takes the lock of the context for command, waiting for it to be
+// released by another process if Options.Wait is set. The lock is held
+// from the resolution of the changes to the end of their application,
+// unlock releases it.
+func (g *Commands) lock(command string) (unlock func(), err error) {
+	var l *config.Lock
+	if l, err = g.context.Lock(command, g.opts.Wait); err != nil {
+		return
+	}
+	g.command = command
+	unlock = func() {
+		if uErr := l.Unlock(); uErr != nil {
+			logf("lock: %v\n", uErr)
+		}
+	}
+	return
+}
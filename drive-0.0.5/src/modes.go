@@ -0,0 +1,147 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drive
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"sync"
+	"syscall"
+
+	drive "github.com/google/google-api-go-client/drive/v2"
+)
+
+// Keys of the private properties holding the POSIX
+// permissions and ownership of pushed files.
+const (
+	ModeProperty  = "mode"
+	OwnerProperty = "owner"
+	GroupProperty = "group"
+)
+
+var (
+	namesMu    sync.Mutex
+	userNames  = map[uint32]string{}
+	groupNames = map[uint32]string{}
+)
+
+func remoteProperty(f *drive.File, key string) string {
+	for _, prop := range f.Properties {
+		if prop != nil && prop.Key == key {
+			return prop.Value
+		}
+	}
+	return ""
+}
+
+// remoteMode returns the permission bits stored on f, 0 if there are none.
+func remoteMode(f *drive.File) os.FileMode {
+	mode, err := strconv.ParseUint(remoteProperty(f, ModeProperty), 8, 32)
+	if err != nil {
+		return 0
+	}
+	return os.FileMode(mode).Perm()
+}
+
+// localOwnership returns the names of the user and group owning a local file.
+// A name that can't be looked up is left empty.
+func localOwnership(info os.FileInfo) (owner, group string) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || st == nil {
+		return
+	}
+
+	namesMu.Lock()
+	defer namesMu.Unlock()
+
+	var cached bool
+	if owner, cached = userNames[st.Uid]; !cached {
+		if u, err := user.LookupId(strconv.Itoa(int(st.Uid))); err == nil {
+			owner = u.Username
+		}
+		userNames[st.Uid] = owner
+	}
+	if group, cached = groupNames[st.Gid]; !cached {
+		if gr, err := user.LookupGroupId(strconv.Itoa(int(st.Gid))); err == nil {
+			group = gr.Name
+		}
+		groupNames[st.Gid] = group
+	}
+	return
+}
+
+func modeProperties(f *File) (props []*drive.Property) {
+	if f.Mode == 0 {
+		return
+	}
+	props = append(props, &drive.Property{
+		Key: ModeProperty, Value: fmt.Sprintf("%04o", f.Mode), Visibility: "PRIVATE",
+	})
+	if f.Owner != "" {
+		props = append(props, &drive.Property{Key: OwnerProperty, Value: f.Owner, Visibility: "PRIVATE"})
+	}
+	if f.Group != "" {
+		props = append(props, &drive.Property{Key: GroupProperty, Value: f.Group, Visibility: "PRIVATE"})
+	}
+	return
+}
+
+// modesDiffer reports whether the mode of src has to be applied to dest.
+// A remote file uploaded without its mode gets it on the next push, while
+// a remote file without a mode leaves the local mode alone on pull.
+func modesDiffer(src, dest *File) bool {
+	return src.Mode != 0 && src.Mode != dest.Mode
+}
+
+// restoreMode applies the permissions stored on the remote f to the local
+// file at absPath. Directories stay accessible to their owner so their
+// contents can still be pulled in. Ownership is only restored when running
+// as root, and only for names known to this system.
+func restoreMode(absPath string, f *File) (err error) {
+	if f.Mode == 0 {
+		return
+	}
+	mode := f.Mode
+	if f.IsDir {
+		mode |= 0700
+	}
+	if err = os.Chmod(absPath, mode); err != nil {
+		return
+	}
+	if os.Geteuid() != 0 || (f.Owner == "" && f.Group == "") {
+		return
+	}
+
+	uid, gid := -1, -1
+	if u, uErr := user.Lookup(f.Owner); uErr == nil {
+		uid, _ = strconv.Atoi(u.Uid)
+	}
+	if gr, gErr := user.LookupGroup(f.Group); gErr == nil {
+		gid, _ = strconv.Atoi(gr.Gid)
+	}
+	return os.Lchown(absPath, uid, gid)
+}
+
+func (g *Commands) localChmod(change *Change) (err error) {
+	defer g.taskDone()
+	return restoreMode(g.localPathOf(change.Path), change.Src)
+}
+
+func (g *Commands) remoteChmod(change *Change) (err error) {
+	defer g.taskDone()
+	return g.rem.SetProperties(change.Dest.Id, modeProperties(change.Src))
+}
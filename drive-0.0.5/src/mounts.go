@@ -0,0 +1,144 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drive
+
+import (
+	"fmt"
+
+	"github.com/odeke-em/drive/config"
+)
+
+type mountRecord struct {
+	Type       string `json:"type"`
+	LocalPath  string `json:"local_path"`
+	RemotePath string `json:"remote_path"`
+}
+
+func printMount(m *config.Mount) {
+	if OutputJSON {
+		emit(&mountRecord{Type: "mount", LocalPath: m.LocalPath, RemotePath: m.RemotePath})
+		return
+	}
+	fmt.Printf("%s -> %s\n", m.RemotePath, m.LocalPath)
+}
+
+// MountAdd registers localPath as the local side of remotePath.
+func (g *Commands) MountAdd(localPath, remotePath string) (err error) {
+	var m *config.Mount
+	if m, err = g.context.AddMount(localPath, remotePath); err != nil {
+		return
+	}
+	printMount(m)
+	return
+}
+
+// MountList prints the mounts registered in the context.
+func (g *Commands) MountList() (err error) {
+	var mounts []*config.Mount
+	if mounts, err = g.context.Mounts(); err != nil {
+		return
+	}
+	for _, m := range mounts {
+		printMount(m)
+	}
+	return
+}
+
+// MountRemove unregisters the mount whose remote or local path is p.
+func (g *Commands) MountRemove(p string) (err error) {
+	var m *config.Mount
+	if m, err = g.context.RemoveMount(p); err != nil {
+		return
+	}
+	logf("Unmounted %s from %s\n", m.RemotePath, m.LocalPath)
+	return
+}
+
+// localPathOf returns the local path of the remote path p,
+// inside a mount or the context.
+func (g *Commands) localPathOf(p string) string {
+	if m := config.FindMount(g.mounts, p); m != nil {
+		return m.LocalPathOf(p)
+	}
+	return g.context.AbsPathOf(p)
+}
+
+// isMountRoot reports whether p is the remote path of a mount.
+func (g *Commands) isMountRoot(p string) bool {
+	for _, m := range g.mounts {
+		if m.RemotePath == p {
+			return true
+		}
+	}
+	return false
+}
+
+// mountsIn returns the mounts to resolve on their own besides the
+// sources, those below a source and those given in Options.Mounts.
+func (g *Commands) mountsIn(sources []string) (mounts []*config.Mount) {
+	for _, m := range g.mounts {
+		if !config.InSparse(g.sparse, m.RemotePath) && !config.SparseAncestor(g.sparse, m.RemotePath) {
+			continue
+		}
+		for _, src := range sources {
+			if m.RemotePath != src && config.IsUnder(m.RemotePath, src) {
+				mounts = append(mounts, m)
+				break
+			}
+		}
+	}
+	for _, m := range g.opts.Mounts {
+		if config.FindMount(mounts, m.RemotePath) == nil {
+			mounts = append(mounts, m)
+		}
+	}
+	return
+}
+
+// skipMounted reports whether the child path p is left out of the
+// resolution of its parent. Mounted paths are resolved on their own,
+// and the remote folders leading to them are never deleted by a push
+// for lack of a local counterpart.
+func (g *Commands) skipMounted(p string, isPush, hasLocal bool) bool {
+	for _, m := range g.mounts {
+		if m.RemotePath == p {
+			return true
+		}
+		if isPush && !hasLocal && config.IsUnder(m.RemotePath, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveSources resolves the changes of the sources and the mounts in them.
+func (g *Commands) resolveSources(isPush bool) (cl []*Change, err error) {
+	for _, relToRootPath := range g.opts.Sources {
+		fsPath := g.localPathOf(relToRootPath)
+		ccl, cErr := g.changeListResolve(relToRootPath, fsPath, isPush)
+		if cErr != nil {
+			return cl, fmt.Errorf("%s: %v", relToRootPath, cErr)
+		}
+		cl = append(cl, ccl...)
+	}
+	for _, m := range g.mountsIn(g.opts.Sources) {
+		ccl, cErr := g.changeListResolve(m.RemotePath, m.LocalPath, isPush)
+		if cErr != nil {
+			return cl, fmt.Errorf("%s: %v", m.RemotePath, cErr)
+		}
+		cl = append(cl, ccl...)
+	}
+	return
+}
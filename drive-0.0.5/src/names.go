@@ -0,0 +1,149 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drive
+
+import (
+	"crypto/md5"
+	"fmt"
+	gopath "path"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/odeke-em/drive/config"
+	"golang.org/x/text/unicode/norm"
+)
+
+// NameMax is the maximum length in bytes of a local file name.
+const NameMax = 255
+
+// localName maps a Drive title to a name that can exist on disk. Percent
+// signs, path separators, control characters, trailing whitespace and the
+// names "." and ".." are percent escaped, and names longer than NameMax are
+// truncated and suffixed with a hash of the title to keep them distinct.
+// Percent signs being escaped first, distinct titles get distinct names.
+// Other than for percent signs and path separators, the mapping can only
+// be reversed through the context's name map.
+func localName(title string) string {
+	if title == "." || title == ".." {
+		return strings.Repeat("%2E", len(title))
+	}
+
+	trimmed := strings.TrimRight(title, " \t")
+	var buf []byte
+	for i := 0; i < len(trimmed); i++ {
+		b := trimmed[i]
+		if b < 0x20 || b == 0x7f || b == '%' {
+			buf = append(buf, fmt.Sprintf("%%%02X", b)...)
+		} else {
+			buf = append(buf, b)
+		}
+	}
+	for _, b := range []byte(title[len(trimmed):]) {
+		buf = append(buf, fmt.Sprintf("%%%02X", b)...)
+	}
+	name := strings.Replace(string(buf), UnescapedPathSep, EscapedPathSep, -1)
+
+	if len(name) > NameMax {
+		suffix := fmt.Sprintf("~%x", md5.Sum([]byte(title)))[:9]
+		cut := NameMax - len(suffix)
+		for cut > 0 && !utf8.RuneStart(name[cut]) {
+			cut -= 1
+		}
+		name = name[:cut] + suffix
+	}
+	return name
+}
+
+// nameToTitle reverses the escaping of percent signs and path separators
+// by localName. A name localName can't have produced, one created locally,
+// is its own title.
+func nameToTitle(name string) string {
+	if !strings.Contains(name, "%") {
+		return name
+	}
+	var buf []byte
+	for i := 0; i < len(name); i++ {
+		switch {
+		case strings.HasPrefix(name[i:], "%25"):
+			buf = append(buf, '%')
+			i += 2
+		case strings.HasPrefix(name[i:], EscapedPathSep):
+			buf = append(buf, UnescapedPathSep...)
+			i += len(EscapedPathSep) - 1
+		default:
+			buf = append(buf, name[i])
+		}
+	}
+	if title := string(buf); localName(title) == name {
+		return title
+	}
+	return name
+}
+
+// normalizedName returns name in NFC, the form names are compared in.
+// Names created on either side keep their original form.
+func normalizedName(name string) string {
+	return norm.NFC.String(name)
+}
+
+// titleForms returns the forms of title to look up on Drive,
+// whose title queries only match exact bytes.
+func titleForms(title string) (forms []string) {
+	forms = append(forms, title)
+	for _, form := range []string{norm.NFC.String(title), norm.NFD.String(title)} {
+		if form != forms[len(forms)-1] && form != title {
+			forms = append(forms, form)
+		}
+	}
+	return
+}
+
+// remoteTitle returns the Drive title of the local file name at relPath,
+// relative to the context root.
+func remoteTitle(context *config.Context, relPath, name string) string {
+	if context != nil {
+		if title, ok := context.Names().Title(relPath); ok && localName(title) == name {
+			return title
+		}
+	}
+	return nameToTitle(name)
+}
+
+// titleOf returns the title f is uploaded with.
+func titleOf(f *File) string {
+	if f.Title != "" {
+		return f.Title
+	}
+	return nameToTitle(f.Name)
+}
+
+// rememberTitle records the title of a pulled file whose local name
+// differs from it, so that it is pushed back under the same title.
+func (g *Commands) rememberTitle(c *Change) error {
+	if c.Src == nil || c.Src.Title == "" || nameToTitle(c.Src.Name) == c.Src.Title {
+		return nil
+	}
+	return g.context.Names().Put(c.Path, c.Src.Title)
+}
+
+// remoteTitles maps the local names along p to Drive titles.
+func (r *Remote) remoteTitles(p string) (titles []string) {
+	parts := strings.Split(p, "/")[1:]
+	for i, part := range parts {
+		relPath := "/" + gopath.Join(parts[:i+1]...)
+		titles = append(titles, remoteTitle(r.context, relPath, part))
+	}
+	return
+}
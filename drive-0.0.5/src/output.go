@@ -0,0 +1,186 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drive
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// OutputJSON when set makes every command write newline delimited JSON
+// records to stdout instead of text. Informational messages and prompts
+// are written to stderr so that stdout stays machine-readable.
+var OutputJSON = false
+
+var outputMu sync.Mutex
+
+type fileRecord struct {
+	Type        string    `json:"type"`
+	Path        string    `json:"path"`
+	Id          string    `json:"id,omitempty"`
+	Name        string    `json:"name"`
+	IsDir       bool      `json:"is_dir"`
+	Size        int64     `json:"size"`
+	ModTime     time.Time `json:"mod_time"`
+	MimeType    string    `json:"mime_type,omitempty"`
+	Md5Checksum string    `json:"md5_checksum,omitempty"`
+	Mode        string    `json:"mode,omitempty"`
+	Etag        string    `json:"etag,omitempty"`
+	Shared      bool      `json:"shared"`
+	Role        string    `json:"role,omitempty"`
+}
+
+type changeRecord struct {
+	Type string      `json:"type"`
+	Op   string      `json:"op"`
+	Path string      `json:"path"`
+	Src  *fileRecord `json:"src,omitempty"`
+	Dest *fileRecord `json:"dest,omitempty"`
+}
+
+type summaryRecord struct {
+	Type     string `json:"type"`
+	Op       string `json:"op"`
+	Count    int64  `json:"count"`
+	SrcSize  int64  `json:"src_size"`
+	DestSize int64  `json:"dest_size"`
+}
+
+type publishRecord struct {
+	Type string `json:"type"`
+	Path string `json:"path"`
+	Id   string `json:"id"`
+	URL  string `json:"url"`
+}
+
+type serviceQuota struct {
+	Name      string `json:"name"`
+	BytesUsed int64  `json:"bytes_used"`
+}
+
+type quotaRecord struct {
+	Type           string          `json:"type"`
+	Name           string          `json:"name"`
+	AccountType    string          `json:"account_type"`
+	BytesUsed      int64           `json:"bytes_used"`
+	BytesFree      int64           `json:"bytes_free"`
+	BytesInTrash   int64           `json:"bytes_in_trash"`
+	BytesTotal     int64           `json:"bytes_total"`
+	BytesAggregate int64           `json:"bytes_aggregate"`
+	Services       []*serviceQuota `json:"services,omitempty"`
+}
+
+type featureRecord struct {
+	Type string  `json:"type"`
+	Name string  `json:"name"`
+	Rate float64 `json:"rate"`
+}
+
+type uploadSizeRecord struct {
+	Type     string `json:"type"`
+	FileType string `json:"file_type"`
+	Size     int64  `json:"size"`
+}
+
+type diffRecord struct {
+	Type string `json:"type"`
+	Path string `json:"path"`
+	Diff string `json:"diff"`
+}
+
+type versionRecord struct {
+	Type    string `json:"type"`
+	Version string `json:"version"`
+}
+
+type errorRecord struct {
+	Type  string `json:"type"`
+	Path  string `json:"path,omitempty"`
+	Op    string `json:"op,omitempty"`
+	Error string `json:"error"`
+}
+
+// emit writes record as a single line of JSON.
+func emit(record interface{}) {
+	outputMu.Lock()
+	defer outputMu.Unlock()
+	json.NewEncoder(os.Stdout).Encode(record)
+}
+
+// logf writes an informational message, to stderr in JSON mode.
+func logf(format string, args ...interface{}) {
+	w := os.Stdout
+	if OutputJSON {
+		w = os.Stderr
+	}
+	fmt.Fprintf(w, format, args...)
+}
+
+func newFileRecord(p string, f *File) *fileRecord {
+	if f == nil {
+		return nil
+	}
+	rec := &fileRecord{
+		Type:        "file",
+		Path:        p,
+		Id:          f.Id,
+		Name:        f.Name,
+		IsDir:       f.IsDir,
+		Size:        f.Size,
+		ModTime:     f.ModTime,
+		MimeType:    f.MimeType,
+		Md5Checksum: f.Md5Checksum,
+		Etag:        f.Etag,
+		Shared:      f.Shared,
+	}
+	if f.Mode != 0 {
+		rec.Mode = fmt.Sprintf("%04o", f.Mode)
+	}
+	if f.UserPermission != nil {
+		rec.Role = f.UserPermission.Role
+	}
+	return rec
+}
+
+func newChangeRecord(c *Change) *changeRecord {
+	return &changeRecord{
+		Type: "change",
+		Op:   opNames[c.Op()],
+		Path: c.Path,
+		Src:  newFileRecord(c.Path, c.Src),
+		Dest: newFileRecord(c.Path, c.Dest),
+	}
+}
+
+// reportError reports an error related to p, which may be empty.
+func reportError(p string, err error) {
+	if OutputJSON {
+		emit(&errorRecord{Type: "error", Path: p, Error: err.Error()})
+		return
+	}
+	if p == "" {
+		fmt.Println(err)
+	} else {
+		fmt.Printf("\033[91m%s\033[00m: %v\n", p, err)
+	}
+}
+
+// ReportError reports an error that aborted a command.
+func ReportError(err error) {
+	reportError("", err)
+}
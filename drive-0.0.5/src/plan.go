@@ -0,0 +1,316 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drive
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/odeke-em/drive/config"
+)
+
+var opNames = map[int]string{
+	OpNone:   "none",
+	OpAdd:    "add",
+	OpDelete: "delete",
+	OpMod:    "mod",
+	OpChmod:  "chmod",
+}
+
+// planFile is the state of one side of a change at planning time.
+type planFile struct {
+	Id          string    `json:"id,omitempty"`
+	Name        string    `json:"name"`
+	IsDir       bool      `json:"is_dir"`
+	Size        int64     `json:"size"`
+	Md5Checksum string    `json:"md5_checksum,omitempty"`
+	Etag        string    `json:"etag,omitempty"`
+	ModTime     time.Time `json:"mod_time"`
+}
+
+type planChange struct {
+	Op        string    `json:"op"`
+	Path      string    `json:"path"`
+	Parent    string    `json:"parent"`
+	ParentId  string    `json:"parent_id,omitempty"`
+	Src       *planFile `json:"src,omitempty"`
+	Dest      *planFile `json:"dest,omitempty"`
+	Force     bool      `json:"force,omitempty"`
+	NoClobber bool      `json:"no_clobber,omitempty"`
+	// Aside is set when the destination is renamed aside
+	Aside bool `json:"rename_aside,omitempty"`
+}
+
+// Plan is a resolved change list saved for later review and execution.
+type Plan struct {
+	Version    string        `json:"version"`
+	Context    string        `json:"context"`
+	Push       bool          `json:"push"`
+	CreatedAt  time.Time     `json:"created_at"`
+	Exports    []string      `json:"exports,omitempty"`
+	ExportsDir string        `json:"exports_dir,omitempty"`
+	Changes    []*planChange `json:"changes"`
+	// The options the changes were resolved with,
+	// for them to be resolved again the same way
+	Conflicts string `json:"conflicts,omitempty"`
+	Symlinks  string `json:"symlinks,omitempty"`
+	Hidden    bool   `json:"hidden,omitempty"`
+	// Mounts are the one-off mounts of the command,
+	// the registered ones are read from the context
+	Mounts []*config.Mount `json:"mounts,omitempty"`
+}
+
+func toPlanFile(f *File) *planFile {
+	if f == nil {
+		return nil
+	}
+	pf := &planFile{
+		Id:      f.Id,
+		Name:    f.Name,
+		IsDir:   f.IsDir,
+		Size:    f.Size,
+		Etag:    f.Etag,
+		ModTime: f.ModTime,
+	}
+	if !f.IsDir {
+		pf.Md5Checksum = md5Checksum(f)
+	}
+	return pf
+}
+
+// newPlan returns an empty plan recording the options of the command.
+func (g *Commands) newPlan(isPush bool, exports []string) *Plan {
+	plan := &Plan{
+		Version:   Version,
+		Context:   g.context.AbsPath,
+		Push:      isPush,
+		CreatedAt: time.Now().UTC(),
+		Conflicts: g.opts.Conflicts,
+		Symlinks:  g.opts.Symlinks,
+		Hidden:    g.opts.Hidden,
+		Mounts:    g.opts.Mounts,
+	}
+	if !isPush {
+		plan.Exports = exports
+		plan.ExportsDir = g.opts.ExportsDir
+	}
+	return plan
+}
+
+func toPlanChange(c *Change) *planChange {
+	return &planChange{
+		Op:        opNames[c.Op()],
+		Path:      c.Path,
+		Parent:    c.Parent,
+		ParentId:  c.ParentId,
+		Src:       toPlanFile(c.Src),
+		Dest:      toPlanFile(c.Dest),
+		Force:     c.Force,
+		NoClobber: c.NoClobber,
+		Aside:     c.RenameAside,
+	}
+}
+
+// savePlan writes cl to Options.PlanOut instead of applying it.
+func (g *Commands) savePlan(cl []*Change, isPush bool) (err error) {
+	plan := g.newPlan(isPush, g.opts.Exports)
+	for _, c := range cl {
+		if c.Op() == OpNone {
+			continue
+		}
+		plan.Changes = append(plan.Changes, toPlanChange(c))
+	}
+
+	var data []byte
+	if data, err = json.MarshalIndent(plan, "", "  "); err != nil {
+		return
+	}
+	if err = ioutil.WriteFile(g.opts.PlanOut, data, 0644); err != nil {
+		return
+	}
+
+	summarizeChanges(cl, true)
+	logf("Saved a plan of %d changes to %s\n", len(plan.Changes), g.opts.PlanOut)
+	return
+}
+
+func readPlan(p string) (plan *Plan, err error) {
+	var data []byte
+	if data, err = ioutil.ReadFile(p); err != nil {
+		return
+	}
+	plan = &Plan{}
+	err = json.Unmarshal(data, plan)
+	return
+}
+
+// Apply executes exactly the changes of the plan saved at planPath.
+// A change is refused if the remote or local content it was planned
+// against changed since, the rest of the plan is still executed.
+func (g *Commands) Apply(planPath string) (err error) {
+	var unlock func()
+	if unlock, err = g.lock(ApplyKey); err != nil {
+		return
+	}
+	defer unlock()
+
+	var plan *Plan
+	if plan, err = readPlan(planPath); err != nil {
+		return
+	}
+	if plan.Context != g.context.AbsPath {
+		return fmt.Errorf("plan was made for context %s, not %s", plan.Context, g.context.AbsPath)
+	}
+	if err = g.restorePlanOptions(plan); err != nil {
+		return
+	}
+
+	var cl []*Change
+	refused := 0
+	for _, pc := range plan.Changes {
+		c, cErr := g.planChangeToChange(pc, plan.Push)
+		if cErr != nil {
+			refused += 1
+			reportError(pc.Path, fmt.Errorf("refused: %v", cErr))
+			continue
+		}
+		cl = append(cl, c)
+	}
+	if refused >= 1 {
+		logf("Refused %d of %d planned changes\n", refused, len(plan.Changes))
+	}
+
+	if !printChangeList(cl, g.opts.NoPrompt, false) {
+		return
+	}
+	if plan.Push {
+		return g.playPushChangeList(cl)
+	}
+	return g.playPullChangeList(cl, plan.Exports)
+}
+
+// restorePlanOptions restores the options and the mounts the changes of plan
+// were resolved with. A plan or journal that didn't record the options gets the
+// defaults, which never delete a side of a type conflict. It fails if the
+// local side of a mount is missing, for its paths not to be taken as deleted.
+func (g *Commands) restorePlanOptions(plan *Plan) (err error) {
+	var mounts []*config.Mount
+	if mounts, err = g.context.Mounts(); err != nil {
+		return
+	}
+	for _, m := range plan.Mounts {
+		checked := m.LocalPath
+		if !plan.Push {
+			// pull creates the mount
+			checked = filepath.Dir(m.LocalPath)
+		}
+		if _, err = os.Stat(checked); err != nil {
+			return fmt.Errorf("mount of %s: %v", m.RemotePath, err)
+		}
+	}
+	g.mounts = append(mounts, plan.Mounts...)
+	g.opts.Mounts = plan.Mounts
+
+	g.opts.Conflicts = plan.Conflicts
+	if g.opts.Conflicts == "" {
+		g.opts.Conflicts = ConflictReport
+	}
+	g.opts.Symlinks = plan.Symlinks
+	if g.opts.Symlinks == "" {
+		g.opts.Symlinks = SymlinksFollow
+	}
+	g.opts.Hidden = plan.Hidden
+	g.opts.ExportsDir = plan.ExportsDir
+	return
+}
+
+// planChangeToChange rebuilds a planned change from the current state of
+// its remote and local sides, failing if either differs from the plan.
+func (g *Commands) planChangeToChange(pc *planChange, isPush bool) (c *Change, err error) {
+	var local, remote *planFile
+	if isPush {
+		local, remote = pc.Src, pc.Dest
+	} else {
+		local, remote = pc.Dest, pc.Src
+	}
+
+	var l, r *File
+	if l, err = g.currentLocal(pc.Path, local); err != nil {
+		return
+	}
+	if r, err = g.currentRemote(pc.Path, remote); err != nil {
+		return
+	}
+
+	c = &Change{Path: pc.Path, Parent: pc.Parent, ParentId: pc.ParentId, Force: pc.Force, NoClobber: pc.NoClobber}
+	c.RenameAside = pc.Aside
+	if isPush {
+		c.Src, c.Dest = l, r
+	} else {
+		c.Src, c.Dest = r, l
+	}
+	if op := opNames[c.Op()]; op != pc.Op {
+		return nil, fmt.Errorf("planned as %s, now resolves to %s", pc.Op, op)
+	}
+	return
+}
+
+func (g *Commands) currentLocal(p string, planned *planFile) (*File, error) {
+	l, err := g.statLocal(p)
+	if err != nil {
+		return nil, err
+	}
+	if planned == nil {
+		if l != nil {
+			return nil, fmt.Errorf("local path was created since planning")
+		}
+		return nil, nil
+	}
+	if l == nil {
+		return nil, fmt.Errorf("local path was removed since planning")
+	}
+	if l.IsDir != planned.IsDir {
+		return nil, fmt.Errorf("local type changed since planning")
+	}
+	if !l.IsDir && (!l.ModTime.Equal(planned.ModTime) || l.Size != planned.Size) {
+		return nil, fmt.Errorf("local content changed since planning")
+	}
+	return l, nil
+}
+
+func (g *Commands) currentRemote(p string, planned *planFile) (*File, error) {
+	if planned == nil {
+		r, err := g.rem.FindByPath(p)
+		if err != nil && err != ErrPathNotExists {
+			return nil, err
+		}
+		if r != nil {
+			return nil, fmt.Errorf("remote path was created since planning")
+		}
+		return nil, nil
+	}
+	r, err := g.rem.FindById(planned.Id)
+	if err != nil {
+		return nil, fmt.Errorf("remote file is no longer accessible: %v", err)
+	}
+	if r.Etag != planned.Etag {
+		return nil, fmt.Errorf("remote etag changed since planning")
+	}
+	return r, nil
+}
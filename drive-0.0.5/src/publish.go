@@ -21,7 +21,7 @@ import (
 func (c *Commands) Publish() (err error) {
 	for _, relToRoot := range c.opts.Sources {
 		if pubErr := c.pub(relToRoot); pubErr != nil {
-			fmt.Printf("\033[91mPub\033[00m %s:  %v\n", relToRoot, pubErr)
+			reportError(relToRoot, pubErr)
 		}
 	}
 	return
@@ -39,14 +39,18 @@ func (c *Commands) pub(relToRoot string) (err error) {
 	if err != nil {
 		return
 	}
-	fmt.Printf("%s Published on %s\n", relToRoot, link)
+	if OutputJSON {
+		emit(&publishRecord{Type: "publish", Path: relToRoot, Id: file.Id, URL: link})
+	} else {
+		fmt.Printf("%s Published on %s\n", relToRoot, link)
+	}
 	return
 }
 
 func (c *Commands) Unpublish() error {
 	for _, relToRoot := range c.opts.Sources {
 		if unpubErr := c.unpub(relToRoot); unpubErr != nil {
-			fmt.Printf("\033[91mUnpub\033[00m %s:  %v\n", relToRoot, unpubErr)
+			reportError(relToRoot, unpubErr)
 		}
 	}
 	return nil
@@ -15,31 +15,34 @@
 package drive
 
 import (
+	"crypto/md5"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
-	"sort"
 	"strings"
 	"sync"
 )
 
-const (
-	maxNumOfConcPullTasks = 4
-)
-
 // Pull from remote if remote path exists and in a god context. If path is a
 // directory, it recursively pulls from the remote if there are remote changes.
 // It doesn't check if there are remote changes if isForce is set.
 func (g *Commands) Pull() (err error) {
+	var unlock func()
+	if unlock, err = g.lock(PullKey); err != nil {
+		return
+	}
+	defer unlock()
+
 	var cl []*Change
-	for _, relToRootPath := range g.opts.Sources {
-		fsPath := g.context.AbsPathOf(relToRootPath)
-		ccl, cErr := g.changeListResolve(relToRootPath, fsPath, false)
-		if cErr == nil && len(ccl) > 0 {
-			cl = append(cl, ccl...)
-		}
+	if cl, err = g.resolveSources(false); err != nil {
+		return
+	}
+
+	if g.opts.PlanOut != "" {
+		return g.savePlan(cl, false)
 	}
 
 	ok := printChangeList(cl, g.opts.NoPrompt, g.opts.NoClobber)
@@ -51,50 +54,45 @@ func (g *Commands) Pull() (err error) {
 }
 
 func (g *Commands) playPullChangeList(cl []*Change, exports []string) (err error) {
-	var next []*Change
-	g.taskStart(len(cl))
-
-	// TODO: Only provide precedence ordering if all the other options are allowed
-	// Currently noop on sorting by precedence
-	if false && !g.opts.NoClobber {
-		sort.Sort(ByPrecedence(cl))
+	if err = g.journalPlan(cl, false, exports); err != nil {
+		return
 	}
-
-	for {
-		if len(cl) > maxNumOfConcPullTasks {
-			next, cl = cl[:maxNumOfConcPullTasks], cl[maxNumOfConcPullTasks:len(cl)]
-		} else {
-			next, cl = cl, []*Change{}
-		}
-		if len(next) == 0 {
-			break
-		}
-		var wg sync.WaitGroup
-		wg.Add(len(next))
-		// play the changes
-		// TODO: add timeouts
-		for _, c := range next {
-			switch c.Op() {
-			case OpMod:
-				go g.localMod(&wg, c, exports)
-			case OpAdd:
-				go g.localAdd(&wg, c, exports)
-			case OpDelete:
-				go g.localDelete(&wg, c)
+	defer g.journalFinish()
+
+	// Changes are streamed to the workers as slots free up, so small
+	// files keep flowing while a large download occupies a worker.
+	// TODO: add timeouts
+	err = g.playConcurrently(cl, g.recorded(false, func(c *Change) (err error) {
+		switch c.Op() {
+		case OpMod:
+			if err = g.localMod(c, exports); err == nil {
+				err = g.rememberTitle(c)
+			}
+			return
+		case OpAdd:
+			if err = g.localAdd(c, exports); err == nil {
+				err = g.rememberTitle(c)
 			}
+			return
+		case OpDelete:
+			return g.localDelete(c)
+		case OpChmod:
+			return g.localChmod(c)
 		}
-		wg.Wait()
-	}
+		g.taskDone()
+		return nil
+	}))
 
-	g.taskFinish()
 	return err
 }
 
-func (g *Commands) localMod(wg *sync.WaitGroup, change *Change, exports []string) (err error) {
+func (g *Commands) localMod(change *Change, exports []string) (err error) {
+	if change.Src.SymlinkTarget != "" {
+		return g.localSymlink(change)
+	}
 	defer g.taskDone()
-	defer wg.Done()
 
-	destAbsPath := g.context.AbsPathOf(change.Path)
+	destAbsPath := g.localPathOf(change.Path)
 
 	// Simple heuristic to avoid downloading all the
 	// content yet it could just be a modTime difference
@@ -105,17 +103,22 @@ func (g *Commands) localMod(wg *sync.WaitGroup, change *Change, exports []string
 			return
 		}
 	}
+	if err = restoreMode(destAbsPath, change.Src); err != nil {
+		return
+	}
 	return os.Chtimes(destAbsPath, change.Src.ModTime, change.Src.ModTime)
 }
 
-func (g *Commands) localAdd(wg *sync.WaitGroup, change *Change, exports []string) (err error) {
-
+func (g *Commands) localAdd(change *Change, exports []string) (err error) {
+	if change.Src.SymlinkTarget != "" {
+		return g.localSymlink(change)
+	}
 	defer g.taskDone()
-	defer wg.Done()
-	destAbsPath := g.context.AbsPathOf(change.Path)
+
+	destAbsPath := g.localPathOf(change.Path)
 
 	// make parent's dir if not exists
-	destAbsDir := g.context.AbsPathOf(change.Parent)
+	destAbsDir := g.localPathOf(change.Parent)
 
 	if destAbsDir != destAbsPath {
 		err = os.MkdirAll(destAbsDir, os.ModeDir|0755)
@@ -125,20 +128,32 @@ func (g *Commands) localAdd(wg *sync.WaitGroup, change *Change, exports []string
 	}
 
 	if change.Src.IsDir {
-		return os.Mkdir(destAbsPath, os.ModeDir|0755)
+		if err = os.Mkdir(destAbsPath, os.ModeDir|0755); err != nil {
+			return
+		}
+		return restoreMode(destAbsPath, change.Src)
 	}
 
 	// download and create
 	if err = g.download(change, exports); err != nil {
 		return
 	}
+	if err = restoreMode(destAbsPath, change.Src); err != nil {
+		return
+	}
 
 	return os.Chtimes(destAbsPath, change.Src.ModTime, change.Src.ModTime)
 }
 
-func (g *Commands) localDelete(wg *sync.WaitGroup, change *Change) (err error) {
+func (g *Commands) localDelete(change *Change) (err error) {
+	if g.isMountRoot(change.Path) {
+		g.taskDone()
+		return fmt.Errorf("refusing to delete the mounted %s", change.Dest.BlobAt)
+	}
+	if change.RenameAside {
+		return g.localRenameAside(change)
+	}
 	defer g.taskDone()
-	defer wg.Done()
 	return os.RemoveAll(change.Dest.BlobAt)
 }
 
@@ -179,6 +194,7 @@ func (g *Commands) export(f *File, destAbsPath string, exports []string) (manife
 	}
 
 	var wg sync.WaitGroup
+	var mu sync.Mutex
 	wg.Add(len(waitables))
 
 	for pathName, exportURL := range waitables {
@@ -187,9 +203,11 @@ func (g *Commands) export(f *File, destAbsPath string, exports []string) (manife
 				wg.Done()
 			}()
 
-			err := g.singleDownload(dest, id, url)
+			err := g.singleDownload(dest, id, url, nil)
 			if err == nil {
+				mu.Lock()
 				manifest = append(manifest, dest)
+				mu.Unlock()
 			}
 			return err
 		}(&wg, pathName, f.Id, exportURL)
@@ -208,9 +226,9 @@ func (g *Commands) download(change *Change, exports []string) (err error) {
 		return fmt.Errorf("Tried to download nil change.Src")
 	}
 
-	destAbsPath := g.context.AbsPathOf(change.Path)
+	destAbsPath := g.localPathOf(change.Path)
 	if change.Src.BlobAt != "" {
-		return g.singleDownload(destAbsPath, change.Src.Id, "")
+		return g.singleDownload(destAbsPath, change.Src.Id, "", change.Src)
 	}
 
 	// We need to touch the empty file to
@@ -228,7 +246,7 @@ func (g *Commands) download(change *Change, exports []string) (err error) {
 		manifest, exportErr := g.export(change.Src, exportDirPath, exports)
 		if exportErr == nil {
 			for _, exportPath := range manifest {
-				fmt.Printf("Exported '%s' to '%s'\n", destAbsPath, exportPath)
+				logf("Exported '%s' to '%s'\n", destAbsPath, exportPath)
 			}
 		}
 		return exportErr
@@ -236,20 +254,24 @@ func (g *Commands) download(change *Change, exports []string) (err error) {
 	return
 }
 
-func (g *Commands) singleDownload(p, id, exportURL string) (err error) {
+// singleDownload downloads into a temporary file next to p and only moves
+// it into place once complete. If expected is set, the size and checksum of
+// the downloaded content have to match its Size and Md5Checksum.
+func (g *Commands) singleDownload(p, id, exportURL string, expected *File) (err error) {
 	var fo *os.File
-	fo, err = os.Create(p)
+	fo, err = ioutil.TempFile(filepath.Dir(p), "."+filepath.Base(p)+".drive")
 	if err != nil {
-		fmt.Println("create", err)
 		return
 	}
+	tmpPath := fo.Name()
 
-	// close fo on exit and check for its returned error
+	// clean up the temporary file unless it was moved into place
 	defer func() {
-		fErr := fo.Close()
-		if fErr != nil {
-			fmt.Println("fErr", fErr)
-			err = fErr
+		if fo != nil {
+			fo.Close()
+		}
+		if err != nil {
+			os.Remove(tmpPath)
 		}
 	}()
 
@@ -264,6 +286,35 @@ func (g *Commands) singleDownload(p, id, exportURL string) (err error) {
 	if err != nil {
 		return err
 	}
-	_, err = io.Copy(fo, blob)
-	return
+
+	h := md5.New()
+	var n int64
+	n, err = io.Copy(io.MultiWriter(fo, h), blob)
+	if err != nil {
+		return
+	}
+
+	if expected != nil && expected.Md5Checksum != "" {
+		if n != expected.Size {
+			return fmt.Errorf("downloaded %d bytes, expected %d", n, expected.Size)
+		}
+		if checksum := fmt.Sprintf("%x", h.Sum(nil)); checksum != expected.Md5Checksum {
+			return fmt.Errorf("downloaded checksum %s, expected %s", checksum, expected.Md5Checksum)
+		}
+	}
+
+	// Keep the permissions of any content being replaced.
+	mode := os.FileMode(0644)
+	if info, sErr := os.Stat(p); sErr == nil {
+		mode = info.Mode().Perm()
+	}
+	if err = fo.Chmod(mode); err != nil {
+		return
+	}
+	err = fo.Close()
+	fo = nil
+	if err != nil {
+		return
+	}
+	return os.Rename(tmpPath, p)
 }
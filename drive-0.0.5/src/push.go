@@ -18,9 +18,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
-	"os/signal"
 	gopath "path"
-	"sort"
 	"strings"
 	"sync"
 
@@ -31,63 +29,55 @@ import (
 // directory, it recursively pushes to the remote if there are local changes.
 // It doesn't check if there are local changes if isForce is set.
 func (g *Commands) Push() (err error) {
-	defer g.clearMountPoints()
+	var unlock func()
+	if unlock, err = g.lock(PushKey); err != nil {
+		return
+	}
+	defer unlock()
 
-	root := g.context.AbsPathOf("")
 	var cl []*Change
-
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt, os.Kill)
-
-	// To Ensure mount points are cleared in the event of external exceptios
-	go func() {
-		_ = <-c
-		g.clearMountPoints()
-		os.Exit(1)
-	}()
-
-	for _, relToRootPath := range g.opts.Sources {
-		fsPath := g.context.AbsPathOf(relToRootPath)
-		ccl, cErr := g.changeListResolve(relToRootPath, fsPath, true)
-		if cErr == nil && len(ccl) > 0 {
-			cl = append(cl, ccl...)
-		}
+	if cl, err = g.resolveSources(true); err != nil {
+		return
 	}
 
-	for _, mt := range g.opts.Mounts {
-		ccl, cerr := lonePush(g, root, mt.Name, mt.MountPath)
-		if cerr == nil {
-			cl = append(cl, ccl...)
-		}
+	if g.opts.PlanOut != "" {
+		return g.savePlan(cl, true)
 	}
 
 	ok := printChangeList(cl, g.opts.NoPrompt, g.opts.NoClobber)
 	if ok {
-		pushSize := reduceToSize(cl, true)
-
-		quotaStatus, qErr := g.QuotaStatus(pushSize)
-		if qErr != nil {
+		if ok, qErr := g.pushQuotaOk(cl); !ok || qErr != nil {
 			return qErr
 		}
-		unSafe := false
-		switch quotaStatus {
-		case AlmostExceeded:
-			fmt.Println("\033[92mAlmost exceeding your drive quota\033[00m")
-		case Exceeded:
-			fmt.Println("\033[91mThis change will exceed your drive quota\033[00m")
-			unSafe = true
-		}
-		if unSafe {
-			fmt.Printf(" projected size: %d (%d)\n", pushSize, prettyBytes(pushSize))
-			if !promptForChanges() {
-				return
-			}
-		}
 		return g.playPushChangeList(cl)
 	}
 	return
 }
 
+// pushQuotaOk warns about the quota implications of pushing cl
+// and reports whether the push should proceed.
+func (g *Commands) pushQuotaOk(cl []*Change) (ok bool, err error) {
+	pushSize := reduceToSize(cl, true)
+
+	quotaStatus, qErr := g.QuotaStatus(pushSize)
+	if qErr != nil {
+		return false, qErr
+	}
+	unSafe := false
+	switch quotaStatus {
+	case AlmostExceeded:
+		logf("\033[92mAlmost exceeding your drive quota\033[00m\n")
+	case Exceeded:
+		logf("\033[91mThis change will exceed your drive quota\033[00m\n")
+		unSafe = true
+	}
+	if unSafe {
+		logf(" projected size: %d (%s)\n", pushSize, prettyBytes(pushSize))
+		return promptForChanges(), nil
+	}
+	return true, nil
+}
+
 func (g *Commands) Touch() (err error) {
 	root := "/"
 	chunkSize := 4
@@ -115,7 +105,7 @@ func (g *Commands) Touch() (err error) {
 					continue
 				}
 				if tErr := g.touch(relToRootPath); tErr != nil {
-					fmt.Printf("touch: %s %v\n", relToRootPath, tErr)
+					reportError(relToRootPath, tErr)
 				}
 			}
 			wg.Done()
@@ -141,61 +131,99 @@ func (g *Commands) touch(relToRootPath string) (err error) {
 }
 
 func (g *Commands) playPushChangeList(cl []*Change) (err error) {
-	g.taskStart(len(cl))
-
-	// TODO: Only provide precedence ordering if all the other options are allowed
-	// Currently noop on sorting by precedence
-	if false && !g.opts.NoClobber {
-		sort.Sort(ByPrecedence(cl))
+	if err = g.journalPlan(cl, true, nil); err != nil {
+		return
 	}
+	defer g.journalFinish()
 
-	for _, c := range cl {
+	linkParentChanges(cl)
+	err = g.playConcurrently(cl, g.recorded(true, func(c *Change) error {
 		switch c.Op() {
 		case OpMod:
-			g.remoteMod(c)
+			return g.remoteMod(c)
 		case OpAdd:
-			g.remoteAdd(c)
+			return g.remoteAdd(c)
 		case OpDelete:
-			g.remoteDelete(c)
+			return g.remoteDelete(c)
+		case OpChmod:
+			return g.remoteChmod(c)
+		}
+		g.taskDone()
+		return nil
+	}))
+	verified := 0
+	for _, c := range cl {
+		if c.Verified {
+			verified += 1
 		}
 	}
-	g.taskFinish()
+	if verified >= 1 {
+		logf("Verified the checksums of %d uploads\n", verified)
+	}
 	return err
 }
 
-func lonePush(g *Commands, parent, absPath, path string) (cl []*Change, err error) {
-	r, err := g.rem.FindByPath(absPath)
-	if err != nil && err != ErrPathNotExists {
-		return
+// linkParentChanges links every change without a ParentId to the change
+// in cl creating its remote parent folder. The executor plays a folder
+// before its contents so the folder's RemoteId is known by then.
+func linkParentChanges(cl []*Change) {
+	folders := map[string]*Change{}
+	for _, c := range cl {
+		if c.Src != nil && c.Src.IsDir {
+			folders[c.Path] = c
+		}
 	}
-
-	var l *File
-	localinfo, _ := os.Stat(path)
-	if localinfo != nil {
-		l = NewLocalFile(path, localinfo)
+	for _, c := range cl {
+		if c.ParentId == "" && c.ParentChange == nil {
+			c.ParentChange = folders[gopath.Dir(c.Path)]
+		}
 	}
-
-	return g.resolveChangeListRecv(true, parent, absPath, r, l)
 }
 
 func (g *Commands) remoteMod(change *Change) (err error) {
 	defer g.taskDone()
-	absPath := g.context.AbsPathOf(change.Path)
-	var parent *File
-	if change.Dest != nil {
-		change.Src.Id = change.Dest.Id // TODO: bad hack
+	absPath := g.localPathOf(change.Path)
+	var parentId string
+	if parentId, err = change.remoteParentId(); err != nil {
+		return
 	}
 
-	p := strings.Split(change.Path, "/")
-	p = append([]string{"/"}, p[:len(p)-1]...)
-	parent, err = g.rem.FindByPath(gopath.Join(p...))
-	if err != nil {
-		fmt.Println(parent, err)
-		return
+	dest := change.Dest
+	for attempt := 1; ; attempt++ {
+		var uploaded *File
+		uploaded, err = g.rem.UpsertByComparison(parentId, absPath, change.Src, dest)
+		if err != nil {
+			return err
+		}
+		change.RemoteId = uploaded.Id
+		err = verifyUpload(change, uploaded)
+		if err == nil || g.opts.Strict || attempt >= maxUploadAttempts {
+			return err
+		}
+		logf("%s: %v, re-uploading\n", change.Path, err)
+
+		// Overwrite the content just uploaded instead of creating a duplicate,
+		// its checksum differs so the content is sent again.
+		dest = uploaded
 	}
+}
 
-	_, err = g.rem.UpsertByComparison(parent.Id, absPath, change.Src, change.Dest)
-	return err
+// verifyUpload compares the checksum Drive computed for the uploaded
+// content with that of the local content and records the result on change.
+func verifyUpload(change *Change, uploaded *File) error {
+	if change.Src.IsDir || uploaded == nil {
+		return nil
+	}
+	change.UploadedChecksum = uploaded.Md5Checksum
+	if uploaded.Md5Checksum == "" {
+		// Nothing to compare with e.g for Docs files.
+		return nil
+	}
+	if checksum := md5Checksum(change.Src); checksum != uploaded.Md5Checksum {
+		return fmt.Errorf("uploaded checksum %s, expected %s", uploaded.Md5Checksum, checksum)
+	}
+	change.Verified = true
+	return nil
 }
 
 func (g *Commands) remoteAdd(change *Change) (err error) {
@@ -204,25 +232,55 @@ func (g *Commands) remoteAdd(change *Change) (err error) {
 
 func (g *Commands) remoteUntrash(change *Change) (err error) {
 	defer g.taskDone()
-	return g.rem.Untrash(change.Src.Id)
+	if err = g.rem.Untrash(change.Src.Id); err == nil {
+		change.RemoteId = change.Src.Id
+	}
+	return
 }
 
 func (g *Commands) remoteDelete(change *Change) (err error) {
+	if change.RenameAside {
+		return g.remoteRenameAside(change)
+	}
 	defer g.taskDone()
 	return g.rem.Trash(change.Dest.Id)
 }
 
-func list(context *config.Context, p string, hidden bool) (files []*File, err error) {
-	absPath := context.AbsPathOf(p)
+func (g *Commands) list(p string) (files []*File, err error) {
+	context := g.context
+	hidden, symlinks := g.opts.Hidden, g.opts.Symlinks
+	absPath := g.localPathOf(p)
+	// Symlink loops are looked for up to the root of the
+	// context, or of the mount the listed path is in.
+	root := context.AbsPathOf("")
+	if m := config.FindMount(g.mounts, p); m != nil {
+		root = m.LocalPath
+	}
 	var f []os.FileInfo
 	f, err = ioutil.ReadDir(absPath)
 	if err != nil {
 		return
 	}
 	for _, file := range f {
-		if hidden || !strings.HasPrefix(file.Name(), ".") {
-			files = append(files, NewLocalFile(gopath.Join(absPath, file.Name()), file))
+		if !hidden && strings.HasPrefix(file.Name(), ".") {
+			continue
+		}
+		fileAbsPath := gopath.Join(absPath, file.Name())
+		local := NewLocalFile(fileAbsPath, file)
+		if file.Mode()&os.ModeSymlink != 0 {
+			if local, err = localLink(root, fileAbsPath, file, symlinks); err != nil {
+				return
+			}
+			if local == nil {
+				continue
+			}
+		}
+		relPath := gopath.Join(p, file.Name())
+		if context.Ignored(relPath, local.IsDir) {
+			continue
 		}
+		local.Title = remoteTitle(context, relPath, local.Name)
+		files = append(files, local)
 	}
 	return
 }
@@ -21,6 +21,7 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	gopath "path"
 	"regexp"
 	"strconv"
 	"strings"
@@ -96,6 +97,7 @@ func mimeTypeFromExt(ext string) string {
 }
 
 type Remote struct {
+	context   *config.Context
 	transport *oauth.Transport
 	service   *drive.Service
 }
@@ -103,7 +105,7 @@ type Remote struct {
 func NewRemoteContext(context *config.Context) *Remote {
 	transport := newTransport(context)
 	service, _ := drive.New(transport.Client())
-	return &Remote{service: service, transport: transport}
+	return &Remote{context: context, service: service, transport: transport}
 }
 
 func hasExportLinks(f *File) bool {
@@ -141,19 +143,17 @@ func (r *Remote) FindByPath(p string) (file *File, err error) {
 	if p == "/" {
 		return r.FindById("root")
 	}
-	parts := strings.Split(p, "/") // TODO: use path.Split instead
-	return r.findByPathRecv("root", parts[1:])
+	return r.findByPathRecv("root", r.remoteTitles(p))
 }
 
 func (r *Remote) FindByPathTrashed(p string) (file *File, err error) {
 	if p == "/" {
 		return r.FindById("root")
 	}
-	parts := strings.Split(p, "/") // TODO: use path.Split instead
-	return r.findByPathTrashed("root", parts[1:])
+	return r.findByPathTrashed("root", r.remoteTitles(p))
 }
 
-func (r *Remote) findByParentIdRaw(parentId string, trashed, hidden bool) (files []*File, err error) {
+func (r *Remote) findByParentIdRaw(parentId, parentPath string, trashed, hidden bool) (files []*File, err error) {
 	req := r.service.Files.List()
 
 	// TODO: use field selectors
@@ -177,7 +177,11 @@ func (r *Remote) findByParentIdRaw(parentId string, trashed, hidden bool) (files
 			if isHidden(f.Title, hidden) { // ignore hidden files if hidden is not set
 				continue
 			}
-			files = append(files, NewRemoteFile(f))
+			file := NewRemoteFile(f)
+			if parentPath != "" && r.context.Ignored(gopath.Join(parentPath, file.Name), file.IsDir) {
+				continue
+			}
+			files = append(files, file)
 		}
 
 		pageToken = results.NextPageToken
@@ -188,12 +192,15 @@ func (r *Remote) findByParentIdRaw(parentId string, trashed, hidden bool) (files
 	return
 }
 
-func (r *Remote) FindByParentId(parentId string, hidden bool) (files []*File, err error) {
-	return r.findByParentIdRaw(parentId, false, hidden)
+// FindByParentId lists the children of parentId. parentPath is the path of
+// the parent relative to the context root, its children are filtered by the
+// .driveignore rules of the context if it is set.
+func (r *Remote) FindByParentId(parentId, parentPath string, hidden bool) (files []*File, err error) {
+	return r.findByParentIdRaw(parentId, parentPath, false, hidden)
 }
 
-func (r *Remote) FindByParentIdTrashed(parentId string, hidden bool) (files []*File, err error) {
-	return r.findByParentIdRaw(parentId, true, hidden)
+func (r *Remote) FindByParentIdTrashed(parentId, parentPath string, hidden bool) (files []*File, err error) {
+	return r.findByParentIdRaw(parentId, parentPath, true, hidden)
 }
 
 func (r *Remote) EmptyTrash() error {
@@ -210,6 +217,18 @@ func (r *Remote) Untrash(id string) error {
 	return err
 }
 
+func (r *Remote) Rename(id, title string) error {
+	_, err := r.service.Files.Patch(id, &drive.File{Title: title}).Do()
+	return err
+}
+
+// SetProperties adds props to the properties of
+// the file, replacing those with the same keys.
+func (r *Remote) SetProperties(id string, props []*drive.Property) error {
+	_, err := r.service.Files.Patch(id, &drive.File{Properties: props}).Do()
+	return err
+}
+
 func (r *Remote) Unpublish(id string) error {
 	return r.service.Permissions.Delete(id, "anyone").Do()
 }
@@ -238,8 +257,12 @@ func (r *Remote) Download(id string, exportURL string) (io.ReadCloser, error) {
 		url = exportURL
 	}
 	resp, err := r.transport.Client().Get(url)
-	if err != nil || resp.StatusCode < 200 || resp.StatusCode > 299 {
-		return resp.Body, err
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("download %s: %s", id, resp.Status)
 	}
 	return resp.Body, nil
 }
@@ -258,25 +281,34 @@ func toUTCString(t time.Time) string {
 }
 
 func (r *Remote) UpsertByComparison(parentId, fsAbsPath string, src, dest *File) (f *File, err error) {
-	var body io.Reader
-	body, err = os.Open(fsAbsPath)
-	if err != nil {
-		return
-	}
-
 	uploaded := &drive.File{
 		// Must ensure that the path is prepared for a URL upload
-		Title:   urlToPath(src.Name, false),
+		Title:   titleOf(src),
 		Parents: []*drive.ParentReference{&drive.ParentReference{Id: parentId}},
 	}
 	if src.IsDir {
 		uploaded.MimeType = DriveFolderMimeType
 	}
 
+	uploaded.Properties = modeProperties(src)
+
+	var body io.Reader
+	if src.SymlinkTarget != "" {
+		body = strings.NewReader(src.SymlinkTarget)
+		uploaded.Properties = append(uploaded.Properties, symlinkProperties(src.SymlinkTarget)...)
+	} else if !src.IsDir {
+		var fh *os.File
+		if fh, err = os.Open(fsAbsPath); err != nil {
+			return
+		}
+		defer fh.Close()
+		body = fh
+	}
+
 	// Ensure that the ModifiedDate is retrieved from local
 	uploaded.ModifiedDate = toUTCString(src.ModTime)
 
-	if src.Id == "" {
+	if dest == nil {
 		req := r.service.Files.Insert(uploaded)
 		if !src.IsDir && body != nil {
 			req = req.Media(body)
@@ -287,16 +319,27 @@ func (r *Remote) UpsertByComparison(parentId, fsAbsPath string, src, dest *File)
 		return NewRemoteFile(uploaded), nil
 	}
 
+	// A stub replaced by content stops being a symlink.
+	if dest.SymlinkTarget != "" && src.SymlinkTarget == "" {
+		if err = r.service.Properties.Delete(dest.Id, SymlinkProperty).Do(); err != nil {
+			return
+		}
+	}
+
+	// The existing title is kept byte for byte, the local name may
+	// only match it once normalized.
+	if dest.Title != "" {
+		uploaded.Title = dest.Title
+	}
+
 	// update the existing
-	req := r.service.Files.Update(src.Id, uploaded)
+	req := r.service.Files.Update(dest.Id, uploaded)
 
 	// We always want it to match up with the local time
 	req.SetModifiedDate(true)
 
 	if !src.IsDir {
-		if dest == nil {
-			req = req.Media(body)
-		} else if mask := fileDifferences(src, dest); checksumDiffers(mask) {
+		if mask := fileDifferences(src, dest); checksumDiffers(mask) {
 			req = req.Media(body)
 		}
 	}
@@ -345,17 +388,34 @@ func (r *Remote) About() (about *drive.About, err error) {
 }
 
 func (r *Remote) findByPathRecvRaw(parentId string, p []string, trashed bool) (file *File, err error) {
-	// find the file or directory under parentId and titled with p[0]
+	// find the file or directory under parentId and titled with p[0],
+	// in any of its normalization forms
+	var first *drive.File
+	for _, head := range titleForms(p[0]) {
+		if first = r.findTitled(parentId, head, trashed); first != nil {
+			break
+		}
+	}
+	if first == nil {
+		return nil, ErrPathNotExists
+	}
+
+	if len(p) == 1 {
+		return NewRemoteFile(first), nil
+	}
+	return r.findByPathRecvRaw(first.Id, p[1:], trashed)
+}
+
+func (r *Remote) findTitled(parentId, title string, trashed bool) *drive.File {
 	req := r.service.Files.List()
 	// TODO: use field selectors
 	var expr string
-	head := urlToPath(p[0], false)
 	quote := strconv.Quote
 	if trashed {
-		expr = fmt.Sprintf("title = %s and trashed=true", quote(head))
+		expr = fmt.Sprintf("title = %s and trashed=true", quote(title))
 	} else {
 		expr = fmt.Sprintf("%s in parents and title = %s and trashed=false",
-			quote(parentId), quote(head))
+			quote(parentId), quote(title))
 	}
 	req.Q(expr)
 
@@ -364,14 +424,9 @@ func (r *Remote) findByPathRecvRaw(parentId string, p []string, trashed bool) (f
 	files, err := req.Do()
 	if err != nil || len(files.Items) < 1 {
 		// TODO: make sure only 404s are handled here
-		return nil, ErrPathNotExists
-	}
-
-	first := files.Items[0]
-	if len(p) == 1 {
-		return NewRemoteFile(first), nil
+		return nil
 	}
-	return r.findByPathRecvRaw(first.Id, p[1:], trashed)
+	return files.Items[0]
 }
 
 func (r *Remote) findByPathRecv(parentId string, p []string) (file *File, err error) {
@@ -0,0 +1,180 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drive
+
+import (
+	"fmt"
+	"os"
+	gopath "path"
+
+	"github.com/odeke-em/drive/config"
+)
+
+type sparseRecord struct {
+	Type string `json:"type"`
+	Path string `json:"path"`
+}
+
+// sparseSources returns the sources in or leading to the sparse set.
+func (g *Commands) sparseSources(sources []string) (kept []string) {
+	for _, src := range sources {
+		if config.InSparse(g.sparse, src) || config.SparseAncestor(g.sparse, src) {
+			kept = append(kept, src)
+		} else {
+			logf("%s: skipped, not in the sparse set\n", src)
+		}
+	}
+	return
+}
+
+// skipSparse reports whether the child path p is left out of the resolution
+// of its parent by the sparse set. A path only leading to the sparse set is
+// resolved for its contents, but is neither deleted remotely for lack of a
+// local counterpart, nor locally for lack of a remote one.
+func (g *Commands) skipSparse(p string, isPush, hasLocal, hasRemote bool) bool {
+	if config.InSparse(g.sparse, p) {
+		return false
+	}
+	if !config.SparseAncestor(g.sparse, p) {
+		return true
+	}
+	if isPush {
+		return !hasLocal
+	}
+	return !hasRemote
+}
+
+func cleanRemotePaths(paths []string) (cleaned []string) {
+	for _, p := range paths {
+		cleaned = append(cleaned, gopath.Clean(gopath.Join("/", p)))
+	}
+	return
+}
+
+// SparseList prints the remote subtrees tracked by the context.
+func (g *Commands) SparseList() error {
+	if len(g.sparse) < 1 {
+		logf("The whole drive is tracked\n")
+	}
+	for _, p := range g.sparse {
+		if OutputJSON {
+			emit(&sparseRecord{Type: "sparse", Path: p})
+		} else {
+			fmt.Println(p)
+		}
+	}
+	return nil
+}
+
+// SparseAdd adds paths to the sparse set and pulls them.
+func (g *Commands) SparseAdd(paths []string) (err error) {
+	paths = cleanRemotePaths(paths)
+	sparse := g.sparse
+	for _, p := range paths {
+		if len(sparse) >= 1 && config.InSparse(sparse, p) {
+			logf("%s: already tracked\n", p)
+			continue
+		}
+		// Subtrees of the added path are now redundant.
+		var kept []string
+		for _, included := range sparse {
+			if !config.IsUnder(included, p) {
+				kept = append(kept, included)
+			}
+		}
+		sparse = append(kept, p)
+	}
+	if err = g.context.SetSparsePaths(sparse); err != nil {
+		return
+	}
+	g.sparse = sparse
+	g.opts.Sources = paths
+	return g.Pull()
+}
+
+// SparseRemove removes paths from the sparse set and deletes their
+// local copies. A path with local changes that weren't pushed is only
+// removed if Options.Force is set. The context is locked throughout, for
+// a concurrent push not to take the evicted files as deleted.
+func (g *Commands) SparseRemove(paths []string) (err error) {
+	paths = cleanRemotePaths(paths)
+
+	var unlock func()
+	if unlock, err = g.lock(SparseKey); err != nil {
+		return
+	}
+	defer unlock()
+	// The set could have changed while waiting for the lock.
+	if g.sparse, err = g.context.SparsePaths(); err != nil {
+		return
+	}
+
+	// Only the subtrees added are evicted, anything else under
+	// a path could be local data that was never synced.
+	removed := map[string]bool{}
+	for _, p := range paths {
+		tracked := false
+		for _, included := range g.sparse {
+			if included == p {
+				tracked = true
+			}
+		}
+		if !tracked {
+			return fmt.Errorf("%s isn't in the sparse set", p)
+		}
+		removed[p] = true
+	}
+
+	var sparse []string
+	for _, included := range g.sparse {
+		if !removed[included] {
+			sparse = append(sparse, included)
+		}
+	}
+	if len(sparse) < 1 {
+		// Nothing is evicted since the whole drive is tracked again.
+		logf("The whole drive is tracked again\n")
+		return g.context.SetSparsePaths(nil)
+	}
+
+	for _, p := range paths {
+		if config.InSparse(sparse, p) {
+			return fmt.Errorf("%s is still in the sparse set", p)
+		}
+		if !g.opts.Force {
+			var cl []*Change
+			if cl, err = g.changeListResolve(p, g.localPathOf(p), true); err != nil && err != ErrPathNotExists {
+				return
+			}
+			for _, c := range cl {
+				if op := c.Op(); op == OpAdd || op == OpMod || op == OpChmod {
+					return fmt.Errorf("%s has local changes, push them first or use -force", p)
+				}
+			}
+		}
+	}
+
+	if err = g.context.SetSparsePaths(sparse); err != nil {
+		return
+	}
+	g.sparse = sparse
+	for _, p := range paths {
+		if err = os.RemoveAll(g.localPathOf(p)); err != nil {
+			return
+		}
+		logf("Evicted %s\n", p)
+	}
+	return
+}
@@ -0,0 +1,143 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drive
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	drive "github.com/google/google-api-go-client/drive/v2"
+	"github.com/odeke-em/drive/config"
+)
+
+// Policies for local symlinks, see Options.Symlinks.
+const (
+	// SymlinksFollow treats a symlink as the file or directory it points to.
+	SymlinksFollow = "follow"
+	// SymlinksSkip ignores symlinks.
+	SymlinksSkip = "skip"
+	// SymlinksPreserve pushes a symlink as a small remote stub
+	// holding its target, from which pull recreates the link.
+	SymlinksPreserve = "preserve"
+)
+
+// SymlinkProperty is the key of the private property
+// holding the target of a symlink stub on the remote.
+const SymlinkProperty = "symlinkTarget"
+
+// CheckSymlinkPolicy returns an error if policy isn't a known symlink policy.
+func CheckSymlinkPolicy(policy string) error {
+	switch policy {
+	case SymlinksFollow, SymlinksSkip, SymlinksPreserve:
+		return nil
+	}
+	return fmt.Errorf("unknown symlink policy %q, expecting %s, %s or %s",
+		policy, SymlinksFollow, SymlinksSkip, SymlinksPreserve)
+}
+
+func remoteSymlinkTarget(f *drive.File) string {
+	return remoteProperty(f, SymlinkProperty)
+}
+
+func symlinkProperties(target string) []*drive.Property {
+	return []*drive.Property{
+		&drive.Property{Key: SymlinkProperty, Value: target, Visibility: "PRIVATE"},
+	}
+}
+
+// localLink resolves the symlink at absPath according to policy. It returns
+// nil if the link should be left out, either by policy or because it dangles
+// or would make a directory loop.
+func localLink(root, absPath string, info os.FileInfo, policy string) (*File, error) {
+	switch policy {
+	case SymlinksSkip:
+		return nil, nil
+	case SymlinksPreserve:
+		target, err := os.Readlink(absPath)
+		if err != nil {
+			return nil, err
+		}
+		f := NewLocalFile(absPath, info)
+		f.SymlinkTarget = target
+		f.Size = int64(len(target))
+		// The permissions of a link are meaningless.
+		f.Mode = 0
+		return f, nil
+	}
+
+	targetInfo, err := os.Stat(absPath)
+	if err != nil {
+		logf("%s: skipping dangling symlink\n", absPath)
+		return nil, nil
+	}
+	if targetInfo.IsDir() && symlinkLoops(root, absPath, targetInfo) {
+		logf("%s: skipping symlink loop\n", absPath)
+		return nil, nil
+	}
+	return NewLocalFile(absPath, targetInfo), nil
+}
+
+// statLocal returns the local file of the remote path p, a symlink being
+// resolved according to Options.Symlinks. It returns nil if there's no
+// such file or the link is left out.
+func (g *Commands) statLocal(p string) (*File, error) {
+	absPath := g.localPathOf(p)
+	info, err := os.Lstat(absPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if info.Mode()&os.ModeSymlink == 0 {
+		return NewLocalFile(absPath, info), nil
+	}
+	root := g.context.AbsPathOf("")
+	if m := config.FindMount(g.mounts, p); m != nil {
+		root = m.LocalPath
+	}
+	return localLink(root, absPath, info, g.opts.Symlinks)
+}
+
+// symlinkLoops reports whether the directory a followed symlink points to,
+// is one of the directories it is reached through up to root. Directories
+// are compared by device and inode, so loops spanning several links and
+// links through other names of the same directory are caught.
+func symlinkLoops(root, absPath string, targetInfo os.FileInfo) bool {
+	for dir := filepath.Dir(absPath); ; dir = filepath.Dir(dir) {
+		dirInfo, err := os.Stat(dir)
+		if err == nil && os.SameFile(dirInfo, targetInfo) {
+			return true
+		}
+		if dir == root || dir == filepath.Dir(dir) {
+			return false
+		}
+	}
+}
+
+// localSymlink recreates the symlink stubbed by change.Src.
+func (g *Commands) localSymlink(change *Change) (err error) {
+	defer g.taskDone()
+
+	destAbsPath := g.localPathOf(change.Path)
+	if err = os.MkdirAll(filepath.Dir(destAbsPath), os.ModeDir|0755); err != nil {
+		return
+	}
+	if err = os.Remove(destAbsPath); err != nil && !os.IsNotExist(err) {
+		return
+	}
+	return os.Symlink(change.Src.SymlinkTarget, destAbsPath)
+}
@@ -0,0 +1,212 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drive
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Sync resolves both the remote-to-local and local-to-remote changes in
+// a single pass over the merged tree and applies them together.
+// Content only present on one side is copied over to the other side, and
+// content present on both sides is settled in favor of the most recently
+// modified copy. Sync never deletes, since without a record of the last
+// sync it can't tell a deletion on one side from an addition on the other.
+func (g *Commands) Sync() (err error) {
+	var unlock func()
+	if unlock, err = g.lock(SyncKey); err != nil {
+		return
+	}
+	defer unlock()
+	// Read again at every run, the history grows with each.
+	g.syncedModes = &syncedModes{path: g.historyPath()}
+
+	var pullCl, pushCl []*Change
+	for _, relToRootPath := range g.opts.Sources {
+		fsPath := g.localPathOf(relToRootPath)
+		pullCcl, pushCcl, cErr := g.syncChangeListResolve(relToRootPath, fsPath)
+		if cErr != nil {
+			return fmt.Errorf("%s: %v", relToRootPath, cErr)
+		}
+		pullCl = append(pullCl, pullCcl...)
+		pushCl = append(pushCl, pushCcl...)
+	}
+	for _, m := range g.mountsIn(g.opts.Sources) {
+		pullCcl, pushCcl, cErr := g.syncChangeListResolve(m.RemotePath, m.LocalPath)
+		if cErr != nil {
+			return fmt.Errorf("%s: %v", m.RemotePath, cErr)
+		}
+		pullCl = append(pullCl, pullCcl...)
+		pushCl = append(pushCl, pushCcl...)
+	}
+
+	cl := append(append([]*Change{}, pullCl...), pushCl...)
+	ok := printChangeList(cl, g.opts.NoPrompt, g.opts.NoClobber)
+	if !ok {
+		return
+	}
+
+	if len(pushCl) >= 1 {
+		if ok, qErr := g.pushQuotaOk(pushCl); !ok || qErr != nil {
+			return qErr
+		}
+	}
+
+	if err = g.playPullChangeList(pullCl, g.opts.Exports); err != nil {
+		return
+	}
+	return g.playPushChangeList(pushCl)
+}
+
+func (g *Commands) syncChangeListResolve(relToRoot, fsPath string) (pullCl, pushCl []*Change, err error) {
+	var r, l *File
+	r, err = g.rem.FindByPath(relToRoot)
+	if err != nil && err != ErrPathNotExists {
+		return
+	}
+	err = nil
+
+	localinfo, _ := os.Stat(fsPath)
+	if localinfo != nil {
+		l = NewLocalFile(fsPath, localinfo)
+		l.Title = remoteTitle(g.context, relToRoot, l.Name)
+	}
+
+	logf("Resolving...\n")
+	return g.resolveSyncChangeListRecv(relToRoot, relToRoot, g.remoteParentId(relToRoot), r, l)
+}
+
+func (g *Commands) resolveSyncChangeListRecv(d, p, parentId string, r, l *File) (pullCl, pushCl []*Change, err error) {
+	if r == nil && l == nil {
+		return
+	}
+
+	if typesConflict(r, l) {
+		// The most recently modified side replaces the other.
+		if l.ModTime.After(r.ModTime) {
+			pushCl, err = g.resolveChangeListRecv(true, d, p, parentId, r, l)
+		} else {
+			pullCl, err = g.resolveChangeListRecv(false, d, p, parentId, r, l)
+		}
+		return
+	}
+
+	// Paths present only on one side are copied over by the one-way resolvers.
+	if l == nil {
+		pullCl, err = g.resolveChangeListRecv(false, d, p, parentId, r, nil)
+		return
+	}
+	if r == nil {
+		pushCl, err = g.resolveChangeListRecv(true, d, p, parentId, nil, l)
+		return
+	}
+
+	if !r.IsDir && !sameFileTillChecksum(l, r) {
+		switch {
+		case hasExportLinks(r):
+			// Docs files can't be pushed back, the remote is authoritative.
+			if modTimeDiffers(fileDifferences(r, l)) {
+				pullCl = g.appendSyncChange(pullCl, d, p, parentId, r, l)
+			}
+		case l.ModTime.After(r.ModTime):
+			pushCl = g.appendSyncChange(pushCl, d, p, parentId, l, r)
+		default:
+			pullCl = g.appendSyncChange(pullCl, d, p, parentId, r, l)
+		}
+	} else if l.SymlinkTarget == "" && r.SymlinkTarget == "" && !hasExportLinks(r) {
+		// Same content, only the modes can differ.
+		if g.pushesMode(p, l, r) {
+			pushCl = g.appendSyncChange(pushCl, d, p, parentId, l, r)
+		} else {
+			pullCl = g.appendSyncChange(pullCl, d, p, parentId, r, l)
+		}
+	}
+
+	if !g.opts.Recursive || !r.IsDir {
+		return
+	}
+
+	var localChildren, remoteChildren []*File
+	localChildren, err = g.list(p)
+	if err != nil {
+		return
+	}
+	remoteChildren, err = g.rem.FindByParentId(r.Id, p, g.opts.Hidden)
+	if err != nil {
+		return
+	}
+
+	dirlist := merge(remoteChildren, localChildren)
+	childPullCls := make([][]*Change, len(dirlist))
+	childPushCls := make([][]*Change, len(dirlist))
+	childErrs := make([]error, len(dirlist))
+	g.resolveConcurrently(len(dirlist), func(i int) {
+		dl := dirlist[i]
+		// Avoiding path.Join which normalizes '/+' to '/'
+		var joined string
+		if p == "/" {
+			joined = "/" + dl.Name()
+		} else {
+			joined = strings.Join([]string{p, dl.Name()}, "/")
+		}
+		// Sync never deletes, only the mounts themselves and the paths
+		// out of the sparse set are left out.
+		if g.skipMounted(joined, false, true) || g.skipSparse(joined, false, true, true) {
+			return
+		}
+		childPullCls[i], childPushCls[i], childErrs[i] = g.resolveSyncChangeListRecv(p, joined, r.Id, dl.remote, dl.local)
+	})
+
+	for i := range dirlist {
+		if childErrs[i] != nil {
+			return pullCl, pushCl, childErrs[i]
+		}
+		pullCl = append(pullCl, childPullCls[i]...)
+		pushCl = append(pushCl, childPushCls[i]...)
+	}
+	return
+}
+
+// pushesMode reports whether the mode of l is pushed to r, rather than the
+// mode of r pulled, for a path whose content is the same on both sides. The
+// side whose mode changed since the path was last synced wins. Otherwise the
+// most recently modified side does, the local one on a tie since a chmod
+// doesn't touch the modification time.
+func (g *Commands) pushesMode(p string, l, r *File) bool {
+	if r.Mode == 0 || l.Mode == r.Mode {
+		return true
+	}
+	if g.syncedModes != nil {
+		if last, ok := g.syncedModes.last(p); ok {
+			if last == r.Mode {
+				return true
+			}
+			if last == l.Mode {
+				return false
+			}
+		}
+	}
+	return !r.ModTime.After(l.ModTime)
+}
+
+func (g *Commands) appendSyncChange(cl []*Change, parent, p, parentId string, src, dest *File) []*Change {
+	change := &Change{Path: p, Src: src, Dest: dest, Parent: parent, ParentId: parentId, NoClobber: g.opts.NoClobber}
+	if change.Op() != OpNone {
+		cl = append(cl, change)
+	}
+	return cl
+}
@@ -17,14 +17,25 @@ package drive
 import (
 	"fmt"
 	"strings"
-	"sync"
 )
 
 func (g *Commands) Trash() (err error) {
+	var unlock func()
+	if unlock, err = g.lock(TrashKey); err != nil {
+		return
+	}
+	defer unlock()
+
 	return g.reduce(g.opts.Sources, true)
 }
 
 func (g *Commands) Untrash() (err error) {
+	var unlock func()
+	if unlock, err = g.lock(UntrashKey); err != nil {
+		return
+	}
+	defer unlock()
+
 	return g.reduce(g.opts.Sources, false)
 }
 
@@ -34,21 +45,21 @@ func (g *Commands) EmptyTrash() error {
 	}
 
 	if !g.opts.NoPrompt {
-		fmt.Println("Empty trash: (Yn)? ")
+		logf("Empty trash: (Yn)? \n")
 
 		input := "Y"
-		fmt.Print("Proceed with the changes? [Y/n]: ")
+		logf("Proceed with the changes? [Y/n]: ")
 		fmt.Scanln(&input)
 
 		if strings.ToUpper(input) != "Y" {
-			fmt.Println("Aborted emptying trash")
+			logf("Aborted emptying trash\n")
 			return nil
 		}
 	}
 
 	err := g.rem.EmptyTrash()
 	if err == nil {
-		fmt.Println("Successfully emptied trash")
+		logf("Successfully emptied trash\n")
 	}
 	return err
 }
@@ -82,7 +93,7 @@ func (g *Commands) reduce(args []string, toTrash bool) error {
 	for _, relToRoot := range args {
 		c, cErr := g.trasher(relToRoot, toTrash)
 		if cErr != nil {
-			fmt.Printf("\033[91m'%s': %v\033[00m\n", relToRoot, cErr)
+			reportError(relToRoot, cErr)
 		} else if c != nil {
 			cl = append(cl, c)
 		}
@@ -96,38 +107,19 @@ func (g *Commands) reduce(args []string, toTrash bool) error {
 }
 
 func (g *Commands) playTrashChangeList(cl []*Change, toTrash bool) (err error) {
-	var next []*Change
-	g.taskStart(len(cl))
-
 	var f = g.remoteUntrash
 	if toTrash {
 		f = g.remoteDelete
 	}
 
-	for {
-		if len(cl) > maxNumOfConcPullTasks {
-			next, cl = cl[:maxNumOfConcPullTasks], cl[maxNumOfConcPullTasks:len(cl)]
-		} else {
-			next, cl = cl, []*Change{}
-		}
-		if len(next) == 0 {
-			break
-		}
-		var wg sync.WaitGroup
-		wg.Add(len(next))
-		// play the changes
-		// TODO: add timeouts
-		for _, c := range next {
-			if c.Op() != OpNone {
-				go func() error {
-					defer wg.Done()
-					return f(c)
-				}()
-			}
+	// TODO: add timeouts
+	err = g.playConcurrently(cl, g.recorded(true, func(c *Change) error {
+		if c.Op() == OpNone {
+			g.taskDone()
+			return nil
 		}
-		wg.Wait()
-	}
+		return f(c)
+	}))
 
-	g.taskFinish()
 	return err
 }
@@ -22,6 +22,7 @@ import (
 	"time"
 
 	drive "github.com/google/google-api-go-client/drive/v2"
+	"github.com/odeke-em/drive/config"
 )
 
 const (
@@ -29,6 +30,8 @@ const (
 	OpAdd
 	OpDelete
 	OpMod
+	// OpChmod only changes the permissions of a file, not its content
+	OpChmod
 )
 
 const (
@@ -43,15 +46,20 @@ const (
 	DriveFolderMimeType = "application/vnd.google-apps.folder"
 )
 
+// maxUploadAttempts is the number of times content is uploaded
+// before giving up on a checksum mismatch.
+const maxUploadAttempts = 3
+
 // Arbitrary value. TODO: Get better definition of BigFileSize.
 var BigFileSize = int64(1024 * 1024 * 400)
 
-var opPrecedence = map[int]int{
-	OpNone:   0,
-	OpDelete: 1,
-	OpAdd:    2,
-	OpMod:    3,
-}
+// Files modified more recently than this might still be getting written
+// to, so their checksums are not cached.
+var ChecksumSettleTime = 2 * time.Second
+
+// checksumCache persists the checksums of local files across runs.
+// It is set up by New once the drive context is known.
+var checksumCache *config.ChecksumCache
 
 type File struct {
 	BlobAt      string
@@ -65,10 +73,25 @@ type File struct {
 	Size        int64
 	Etag        string
 	Shared      bool
+	// Title is the exact Drive title of a remote file, or the title
+	// a local file whose name had to be changed is pushed back under
+	Title string
+	// Mode holds the permission bits of a local file or those
+	// stored on a remote one, 0 if they are unknown
+	Mode os.FileMode
+	// Owner and Group are the names owning a local file or
+	// those stored on a remote one
+	Owner string
+	Group string
+	// SymlinkTarget is the target of a preserved symlink,
+	// either local or stubbed on the remote
+	SymlinkTarget string
 	// UserPermission contains the permissions for the authenticated user on this file
 	UserPermission *drive.Permission
 	// CacheChecksum when set avoids recomputation of checksums
 	CacheChecksum bool
+	// checksumKey identifies the content of a local file in the checksum cache
+	checksumKey string
 }
 
 func NewRemoteFile(f *drive.File) *File {
@@ -82,58 +105,71 @@ func NewRemoteFile(f *drive.File) *File {
 		IsDir:       f.MimeType == DriveFolderMimeType,
 		Md5Checksum: f.Md5Checksum,
 		MimeType:    f.MimeType,
+		Mode:        remoteMode(f),
 		ModTime:     mtime,
 		// We must convert each title to match that on the FS.
-		Name:           urlToPath(f.Title, true),
+		Name:           localName(f.Title),
+		Title:          f.Title,
 		Size:           f.FileSize,
+		Owner:          remoteProperty(f, OwnerProperty),
+		Group:          remoteProperty(f, GroupProperty),
 		Shared:         f.Shared,
+		SymlinkTarget:  remoteSymlinkTarget(f),
 		UserPermission: f.UserPermission,
 	}
 }
 
 func NewLocalFile(absPath string, f os.FileInfo) *File {
+	owner, group := localOwnership(f)
 	return &File{
 		Id:      "",
 		Name:    f.Name(),
 		ModTime: f.ModTime().Round(time.Second),
 		IsDir:   f.IsDir(),
+		Mode:    f.Mode().Perm(),
+		Owner:   owner,
+		Group:   group,
 		Size:    f.Size(),
 		BlobAt:  absPath,
-		// TODO: Read the CacheChecksum toggle dynamically if set
-		// by the requester ie if the file is rapidly changing.
-		CacheChecksum: true,
+		// Rapidly changing files shouldn't have their checksums cached.
+		CacheChecksum: time.Since(f.ModTime()) > ChecksumSettleTime,
+		checksumKey:   config.ChecksumKey(f),
 	}
 }
 
 type Change struct {
-	Dest      *File
-	Parent    string
+	Dest   *File
+	Parent string
+	// ParentId is the id of the remote folder the change is pushed into,
+	// empty if that folder doesn't exist yet when resolving.
+	ParentId string
+	// ParentChange is the change creating the remote folder the change
+	// is pushed into, when ParentId is empty.
+	ParentChange *Change
+	// RemoteId is the id of the remote file once the change is pushed
+	RemoteId  string
 	Path      string
 	Src       *File
 	Force     bool
 	NoClobber bool
+	// RenameAside when set on a change between a folder and a file renames
+	// the destination aside instead of deleting it
+	RenameAside bool
+	// UploadedChecksum is the md5 checksum Drive reported for pushed content
+	UploadedChecksum string
+	// Verified is set once UploadedChecksum matched the local content
+	Verified bool
 }
 
-type ByPrecedence []*Change
-
-func (cl ByPrecedence) Less(i, j int) bool {
-	if cl[i] == nil {
-		return false
+// remoteParentId returns the id of the remote folder to push change into.
+func (change *Change) remoteParentId() (string, error) {
+	if change.ParentId != "" {
+		return change.ParentId, nil
 	}
-	if cl[j] == nil {
-		return true
+	if change.ParentChange != nil && change.ParentChange.RemoteId != "" {
+		return change.ParentChange.RemoteId, nil
 	}
-
-	rank1, rank2 := opPrecedence[cl[i].Op()], opPrecedence[cl[j].Op()]
-	return rank1 < rank2
-}
-
-func (cl ByPrecedence) Len() int {
-	return len(cl)
-}
-
-func (cl ByPrecedence) Swap(i, j int) {
-	cl[i], cl[j] = cl[j], cl[i]
+	return "", fmt.Errorf("remote parent folder of %s does not exist", change.Path)
 }
 
 func (self *File) sameDirType(other *File) bool {
@@ -148,6 +184,8 @@ func opToString(op int) (string, string) {
 		return "\033[31m-\033[0m", "Deletion"
 	case OpMod:
 		return "\033[33mM\033[0m", "Modification"
+	case OpChmod:
+		return "\033[36mP\033[0m", "Permission change"
 	default:
 		return "", ""
 	}
@@ -169,12 +207,30 @@ func md5Checksum(f *File) string {
 	if f.Md5Checksum != "" {
 		return f.Md5Checksum
 	}
+	if checksum, ok := checksumCache.Get(f.checksumKey); ok {
+		f.Md5Checksum = checksum
+		return checksum
+	}
 
+	checksum := computeMd5Checksum(f)
+	if checksum != "" && f.CacheChecksum {
+		f.Md5Checksum = checksum
+		checksumCache.Put(f.checksumKey, checksum)
+	}
+	return checksum
+}
+
+// computeMd5Checksum hashes the local content of f, bypassing any caches.
+func computeMd5Checksum(f *File) string {
 	if f.largeFile() { // Just warn the user in case of impatience.
 		// TODO: Only turn on warnings if verbosity is set.
-		fmt.Printf("\033[91mmd5Checksum\033[00m: `%s` (%v)\nmight take time to checksum.\n",
+		logf("\033[91mmd5Checksum\033[00m: `%s` (%v)\nmight take time to checksum.\n",
 			f.Name, prettyBytes(f.Size))
 	}
+	if f.SymlinkTarget != "" {
+		// The content of a preserved link is its target.
+		return fmt.Sprintf("%x", md5.Sum([]byte(f.SymlinkTarget)))
+	}
 	fh, err := os.Open(f.BlobAt)
 
 	if err != nil {
@@ -187,12 +243,7 @@ func md5Checksum(f *File) string {
 	if err != nil {
 		return ""
 	}
-	checksum := fmt.Sprintf("%x", h.Sum(nil))
-	if f.CacheChecksum {
-		// fmt.Println("CACHING CHECKSUM", checksum, f.Name)
-		f.Md5Checksum = checksum
-	}
-	return checksum
+	return fmt.Sprintf("%x", h.Sum(nil))
 }
 
 // if it's a regular file, see it it's modified.
@@ -262,10 +313,20 @@ func (c *Change) op() int {
 	if c.Src.IsDir != c.Dest.IsDir {
 		return OpMod
 	}
+	if c.Src.SymlinkTarget != "" || c.Dest.SymlinkTarget != "" {
+		// Only the target of a link matters, not its own times.
+		if c.Src.SymlinkTarget != c.Dest.SymlinkTarget {
+			return OpMod
+		}
+		return OpNone
+	}
 
 	if !c.Src.IsDir && !sameFileTillChecksum(c.Src, c.Dest) {
 		return OpMod
 	}
+	if modesDiffer(c.Src, c.Dest) {
+		return OpChmod
+	}
 	return OpNone
 }
 
@@ -0,0 +1,234 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drive
+
+import (
+	"os"
+	gopath "path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/odeke-em/drive/config"
+	"gopkg.in/fsnotify.v1"
+)
+
+// DefaultWatchDelay is the default time a watched path has
+// to stay untouched before it's pushed.
+const DefaultWatchDelay = 2 * time.Second
+
+// MinWatchDelay is the shortest time a watched path has to stay untouched,
+// shorter delays can't tell a settled file from one being written.
+const MinWatchDelay = 100 * time.Millisecond
+
+// pendingPath is a watched path changed since it was last pushed.
+type pendingPath struct {
+	// touched is the time of the last event or change of stat
+	touched time.Time
+	size    int64
+	modTime time.Time
+	exists  bool
+}
+
+// sameStat reports whether the stat of absPath is the one recorded in pending,
+// recording it otherwise.
+func (pending *pendingPath) sameStat(absPath string) bool {
+	var size int64
+	var modTime time.Time
+	info, err := os.Lstat(absPath)
+	exists := err == nil
+	if exists {
+		size, modTime = info.Size(), info.ModTime()
+	}
+	if exists == pending.exists && size == pending.size && modTime.Equal(pending.modTime) {
+		return true
+	}
+	pending.size, pending.modTime, pending.exists = size, modTime, exists
+	return false
+}
+
+// Watch pushes the changes of the sources as they happen. Bursts of events
+// are pushed together once the changed paths have stayed untouched for
+// Options.Delay, a file still growing or being rewritten is left for later.
+// Hidden and ignored paths are left out like they are by push, following
+// the changes made to .driveignore files while watching.
+func (g *Commands) Watch() (err error) {
+	var watcher *fsnotify.Watcher
+	if watcher, err = fsnotify.NewWatcher(); err != nil {
+		return
+	}
+	defer watcher.Close()
+
+	for _, src := range g.opts.Sources {
+		if err = g.watchTree(watcher, src); err != nil {
+			return
+		}
+	}
+
+	pending := map[string]*pendingPath{}
+	ticker := time.NewTicker(g.opts.Delay / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case event := <-watcher.Events:
+			if filepath.Base(event.Name) == config.IgnoreFileName {
+				g.ignoreChanged(watcher, event.Name)
+			}
+			p, ok := g.watchedPath(event.Name)
+			if !ok {
+				continue
+			}
+			logf("%s: %s\n", p, strings.ToLower(event.Op.String()))
+			if event.Op&fsnotify.Create != 0 {
+				if info, sErr := os.Lstat(event.Name); sErr == nil && info.IsDir() {
+					if wErr := g.watchTree(watcher, p); wErr != nil {
+						logf("%s: %v\n", p, wErr)
+					}
+				}
+			}
+			if pending[p] == nil {
+				pending[p] = &pendingPath{}
+				pending[p].sameStat(event.Name)
+			}
+			pending[p].touched = time.Now()
+		case wErr := <-watcher.Errors:
+			logf("watch: %v\n", wErr)
+		case now := <-ticker.C:
+			var ready []string
+			for p, pp := range pending {
+				if now.Sub(pp.touched) < g.opts.Delay {
+					continue
+				}
+				if _, ok := g.watchedPath(g.context.AbsPathOf(p)); !ok {
+					// Ignored since it changed.
+					delete(pending, p)
+					continue
+				}
+				if !pp.sameStat(g.context.AbsPathOf(p)) {
+					// Still being written to.
+					pp.touched = now
+					continue
+				}
+				ready = append(ready, p)
+			}
+			for _, p := range ready {
+				delete(pending, p)
+			}
+			if len(ready) >= 1 {
+				g.watchPush(ready)
+			}
+		}
+	}
+}
+
+// ignoreChanged makes the changes of the .driveignore file at absPath
+// apply to the next events, watching the directories it stopped ignoring.
+func (g *Commands) ignoreChanged(watcher *fsnotify.Watcher, absPath string) {
+	g.context.RefreshIgnored()
+	relDir, err := filepath.Rel(g.context.AbsPathOf(""), filepath.Dir(absPath))
+	if err != nil {
+		return
+	}
+	p := gopath.Join("/", filepath.ToSlash(relDir))
+	logf("%s: ignore rules changed\n", gopath.Join(p, config.IgnoreFileName))
+	if wErr := g.watchTree(watcher, p); wErr != nil {
+		logf("%s: %v\n", p, wErr)
+	}
+}
+
+// watchTree watches the directories of the tree at the remote path p,
+// skipping hidden and ignored ones.
+func (g *Commands) watchTree(watcher *fsnotify.Watcher, p string) error {
+	root := g.context.AbsPathOf("")
+	return filepath.Walk(g.context.AbsPathOf(p), func(absPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		relPath, _ := filepath.Rel(root, absPath)
+		relPath = gopath.Join("/", filepath.ToSlash(relPath))
+		if relPath != p && g.skipWatched(relPath, true) {
+			return filepath.SkipDir
+		}
+		logf("Watching %s\n", relPath)
+		return watcher.Add(absPath)
+	})
+}
+
+// watchedPath returns the remote path of absPath and
+// whether its events are of interest.
+func (g *Commands) watchedPath(absPath string) (p string, ok bool) {
+	relPath, err := filepath.Rel(g.context.AbsPathOf(""), absPath)
+	if err != nil || strings.HasPrefix(relPath, "..") {
+		return "", false
+	}
+	p = gopath.Join("/", filepath.ToSlash(relPath))
+	info, err := os.Lstat(absPath)
+	isDir := err == nil && info.IsDir()
+	return p, !g.skipWatched(p, isDir)
+}
+
+func (g *Commands) skipWatched(p string, isDir bool) bool {
+	if config.IsUnder(p, "/.gd") {
+		return true
+	}
+	if !g.opts.Hidden && strings.HasPrefix(gopath.Base(p), ".") {
+		return true
+	}
+	if !config.InSparse(g.sparse, p) && !config.SparseAncestor(g.sparse, p) {
+		return true
+	}
+	return g.context.Ignored(p, isDir)
+}
+
+// watchPush resolves and pushes the changes of the paths, those within
+// another one are resolved with it. Errors are logged, not returned,
+// for the watch to go on.
+func (g *Commands) watchPush(paths []string) {
+	sort.Strings(paths)
+	var sources []string
+	for _, p := range paths {
+		if n := len(sources); n >= 1 && config.IsUnder(p, sources[n-1]) {
+			continue
+		}
+		sources = append(sources, p)
+	}
+	g.opts.Sources = sources
+
+	unlock, err := g.lock(WatchKey)
+	if err != nil {
+		logf("watch: %v\n", err)
+		return
+	}
+	defer unlock()
+
+	cl, err := g.resolveSources(true)
+	if err != nil {
+		logf("watch: %v\n", err)
+		return
+	}
+	if !printChangeList(cl, true, g.opts.NoClobber) {
+		return
+	}
+	if err = g.playPushChangeList(cl); err != nil {
+		logf("watch: %v\n", err)
+		return
+	}
+	logf("Pushed %d change(s)\n", len(cl))
+}